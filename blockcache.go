@@ -0,0 +1,153 @@
+package httprange
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WithBlockCache keeps the last maxBlocks blocks of blockSize bytes read
+// by ReadAt in memory, reads are aligned on the blocks and the cached ones
+// are served without any request. It cuts the round trips of readers
+// seeking around hot regions, like archive/zip reading the central
+// directory. The blocks are dropped when a read detects the file changed.
+// The reader and its clones share the cache, it is meant for random access
+// and not for the downloads, which read every byte once.
+func WithBlockCache(blockSize, maxBlocks int) Option {
+	return func(c *config) {
+		if blockSize <= 0 || maxBlocks <= 0 {
+			c.blocks = nil
+			return
+		}
+		c.blocks = newBlockCache(blockSize, maxBlocks)
+	}
+}
+
+// blockCache is an LRU of the blocks of the file by index.
+// The last block of the file may be shorter than blockSize.
+type blockCache struct {
+	blockSize int64
+	maxBlocks int
+	mu        sync.Mutex
+	order     *list.List
+	blocks    map[int64]*list.Element
+}
+
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+func newBlockCache(blockSize, maxBlocks int) *blockCache {
+	return &blockCache{
+		blockSize: int64(blockSize),
+		maxBlocks: maxBlocks,
+		order:     list.New(),
+		blocks:    make(map[int64]*list.Element),
+	}
+}
+
+func (b *blockCache) get(index int64) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var elem, ok = b.blocks[index]
+	if !ok {
+		return nil, false
+	}
+	b.order.MoveToFront(elem)
+	return elem.Value.(*cachedBlock).data, true
+}
+
+func (b *blockCache) has(index int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var _, ok = b.blocks[index]
+	return ok
+}
+
+// put keeps a copy of data as the block index.
+func (b *blockCache) put(index int64, data []byte) {
+	var block = &cachedBlock{index: index, data: append([]byte(nil), data...)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elem, ok := b.blocks[index]; ok {
+		elem.Value = block
+		b.order.MoveToFront(elem)
+		return
+	}
+	b.blocks[index] = b.order.PushFront(block)
+	for b.order.Len() > b.maxBlocks {
+		var last = b.order.Back()
+		b.order.Remove(last)
+		delete(b.blocks, last.Value.(*cachedBlock).index)
+	}
+}
+
+func (b *blockCache) purge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.order.Init()
+	b.blocks = make(map[int64]*list.Element)
+}
+
+// readBlocks is readAt through the block cache, a run of missing blocks
+// is fetched with a single request.
+func (ra *HTTPReaderAt) readBlocks(req *http.Request, p []byte, off int64) (int, error) {
+	var bc = ra.cfg.blocks
+	var bs = bc.blockSize
+	var end = off + int64(len(p))
+	var n int
+	for n < len(p) {
+		var pos = off + int64(n)
+		var index = pos / bs
+		if block, ok := bc.get(index); ok {
+			var inBlock = pos - index*bs
+			if inBlock >= int64(len(block)) {
+				return n, io.EOF
+			}
+			var c = copy(p[n:], block[inBlock:])
+			ra.cfg.noteCache(pos, c, true)
+			n += c
+			if n < len(p) && int64(len(block)) < bs {
+				// the last block of the file
+				return n, io.EOF
+			}
+			continue
+		}
+		var last = index
+		for (last+1)*bs < end && !bc.has(last+1) {
+			last++
+		}
+		var buf = make([]byte, (last-index+1)*bs)
+		var m, err = ra.fetchAt(req, buf, index*bs)
+		if err != nil && err != io.EOF {
+			if errors.Is(err, ErrValidationFailed) {
+				bc.purge()
+			}
+			return n, err
+		}
+		for i := int64(0); i*bs < int64(m); i++ {
+			var blockEnd = (i + 1) * bs
+			if blockEnd > int64(m) {
+				if err != io.EOF {
+					break
+				}
+				blockEnd = int64(m)
+			}
+			bc.put(index+i, buf[i*bs:blockEnd])
+		}
+		var inBuf = pos - index*bs
+		if inBuf >= int64(m) {
+			return n, io.EOF
+		}
+		var c = copy(p[n:], buf[inBuf:m])
+		ra.cfg.noteCache(pos, c, false)
+		n += c
+		if n < len(p) && m < len(buf) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
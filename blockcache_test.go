@@ -0,0 +1,78 @@
+package httprange
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// makeZip returns a zip archive storing the files uncompressed, so their
+// size in the archive is the one of their content.
+func makeZip(t testing.TB, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	var zw = zip.NewWriter(&buf)
+	for name, content := range files {
+		var w, err = zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newCountingServer serves data with range support and counts the requests.
+func newCountingServer(data []byte, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+}
+
+func TestBlockCacheZip(t *testing.T) {
+	// the member is far from the tail fetched by OpenZip
+	var member = make([]byte, 200*1024)
+	rand.New(rand.NewSource(1)).Read(member)
+	var archive = makeZip(t, map[string][]byte{"member": member, "pad": make([]byte, 100*1024)})
+	var requests atomic.Int32
+	var srv = newCountingServer(archive, &requests)
+	defer srv.Close()
+
+	var zr, closeFn, err = OpenZip(context.Background(), srv.Client(), srv.URL, WithBlockCache(32*1024, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFn()
+	var readMember = func() []byte {
+		var f, err = zr.Open("member")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var content, _ = io.ReadAll(f)
+		return content
+	}
+
+	if !bytes.Equal(readMember(), member) {
+		t.Fatal("first read differs")
+	}
+	requests.Store(0)
+	if !bytes.Equal(readMember(), member) {
+		t.Fatal("second read differs")
+	}
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("second read made %v requests, expect 0", n)
+	}
+}
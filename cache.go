@@ -0,0 +1,57 @@
+package httprange
+
+import "sync/atomic"
+
+// CacheStats counts the reads served from the bytes kept in memory by the
+// reader, the tail of OpenZip, the probe bytes of WithProbeSize or the
+// file of WithTinyFile, and the ones fetched from the network.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+	// BytesServed is the number of bytes of the hits
+	BytesServed int64
+	// BytesFetched is the number of bytes of the misses
+	BytesFetched int64
+}
+
+// CacheObserver is called after every read with its offset, the number
+// of bytes read and whether they came from memory.
+type CacheObserver func(off int64, n int, hit bool)
+
+// WithCacheObserver sets a CacheObserver, to tune the cache sizes for a
+// workload read by read. It is called concurrently by concurrent reads.
+// HTTPReaderAt.CacheStats returns the cumulative counters without it.
+func WithCacheObserver(fn CacheObserver) Option {
+	return func(c *config) {
+		c.cacheObserver = fn
+	}
+}
+
+type cacheCounters struct {
+	hits, misses, served, fetched atomic.Int64
+}
+
+// noteCache counts a read of n bytes at off.
+func (c *config) noteCache(off int64, n int, hit bool) {
+	if hit {
+		c.cache.hits.Add(1)
+		c.cache.served.Add(int64(n))
+	} else {
+		c.cache.misses.Add(1)
+		c.cache.fetched.Add(int64(n))
+	}
+	if c.cacheObserver != nil {
+		c.cacheObserver(off, n, hit)
+	}
+}
+
+// CacheStats returns the cache counters of the reader and its clones.
+func (ra *HTTPReaderAt) CacheStats() CacheStats {
+	var c = &ra.cfg.cache
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		BytesServed:  c.served.Load(),
+		BytesFetched: c.fetched.Load(),
+	}
+}
@@ -0,0 +1,30 @@
+package httprange
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// CacheKey returns a stable key of the file read by ra, for caches, resume
+// stores and the like, see CacheKeyFor. The URL is the one of the prototype
+// request.
+func CacheKey(ra *HTTPReaderAt) string {
+	return CacheKeyFor(ra.req.URL.String(), ra.ETag(), ra.Size())
+}
+
+// CacheKeyFor returns a deterministic key for a file version, a hex encoded
+// SHA-256 of the URL, the ETag and the size, so changing any of them changes the key.
+func CacheKeyFor(url, etag string, size int64) string {
+	return hashFields(url, etag, strconv.FormatInt(size, 10))
+}
+
+// hashFields returns the hex encoded SHA-256 of fields.
+func hashFields(fields ...string) string {
+	var h = sha256.New()
+	// the lengths prefix every field, the key of ("ab", "c") is not the one of ("a", "bc")
+	for _, field := range fields {
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
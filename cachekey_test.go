@@ -0,0 +1,41 @@
+package httprange
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCacheKeyFor(t *testing.T) {
+	var base = CacheKeyFor("http://example.com/f", `"v1"`, 100)
+	if CacheKeyFor("http://example.com/f", `"v1"`, 100) != base {
+		t.Fatal("the key is not deterministic")
+	}
+	var tests = []struct {
+		name, url, etag string
+		size            int64
+	}{
+		{"url", "http://example.com/g", `"v1"`, 100},
+		{"etag", "http://example.com/f", `"v2"`, 100},
+		{"no etag", "http://example.com/f", "", 100},
+		{"size", "http://example.com/f", `"v1"`, 101},
+		{"unknown size", "http://example.com/f", `"v1"`, -1},
+		// the same bytes split differently between the fields
+		{"shifted", "http://example.com/f\"", `v1"`, 100},
+	}
+	for _, tt := range tests {
+		if CacheKeyFor(tt.url, tt.etag, tt.size) == base {
+			t.Errorf("changing the %v kept the key", tt.name)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	var req, _ = http.NewRequest(http.MethodGet, "http://example.com/f", nil)
+	var ra, err = New(NewFileRequester([]byte("cache key")), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := CacheKey(ra), CacheKeyFor("http://example.com/f", ra.ETag(), 9); got != expect {
+		t.Fatalf("got %v, expect %v", got, expect)
+	}
+}
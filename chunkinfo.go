@@ -0,0 +1,26 @@
+package httprange
+
+import "context"
+
+// ChunkInfo is the part of the file a chunk request of a download asks for.
+type ChunkInfo struct {
+	Offset int64
+	Length int64
+}
+
+// chunkInfoKey is the context key of the ChunkInfo of a chunk request.
+type chunkInfoKey struct{}
+
+// ChunkInfoFromContext returns the ChunkInfo of a request sent by a
+// download, for Requester middlewares logging or metering per chunk.
+// Call it with the context of the request given to the Requester.
+// It reports false for the other requests: the probe, the final
+// validation and the reads made directly with ReadAt.
+func ChunkInfoFromContext(ctx context.Context) (ChunkInfo, bool) {
+	var info, ok = ctx.Value(chunkInfoKey{}).(ChunkInfo)
+	return info, ok
+}
+
+func withChunkInfo(ctx context.Context, offset, length int64) context.Context {
+	return context.WithValue(ctx, chunkInfoKey{}, ChunkInfo{Offset: offset, Length: length})
+}
@@ -0,0 +1,37 @@
+package httprange
+
+import (
+	"context"
+	"os"
+)
+
+// WithCleanupOnCancel makes the downloads to a file remove it when they
+// end because ctx is canceled or its deadline, or the one of WithTimeout,
+// passed, so an interrupted
+// run leaves no partial file. Other failures keep the partial file.
+// Only a file created by the download is removed: the existing file left
+// untouched by WithSkipVerified, or a file owned by the caller given to
+// DoToOpenFile, never are.
+func WithCleanupOnCancel() Option {
+	return func(c *config) {
+		c.cleanupOnCancel = true
+	}
+}
+
+// removeOnCancel closes and removes file if the download failed with
+// err because ctx is done, or the deadline of WithTimeout passed, and
+// WithCleanupOnCancel is set, it returns err.
+func (c *config) removeOnCancel(ctx context.Context, file *os.File, err error) error {
+	if err == nil || !c.cleanupOnCancel {
+		return err
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = c.withDeadline(ctx)
+	defer cancel()
+	if ctx.Err() == nil {
+		return err
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return err
+}
@@ -0,0 +1,79 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithCleanupOnCancel(t *testing.T) {
+	var data = bytes.Repeat([]byte("cleanup"), 1000)
+	var tests = []struct {
+		name string
+		// cancelAt is the request canceling the download, 2 is the first chunk
+		cancelAt int32
+		opts     []Option
+		kept     bool
+	}{
+		{"before any write", 2, []Option{WithCleanupOnCancel()}, false},
+		{"midway", 4, []Option{WithCleanupOnCancel()}, false},
+		{"without the option", 4, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			var requests atomic.Int32
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == tt.cancelAt {
+					cancel()
+					<-r.Context().Done()
+					return
+				}
+				http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+			}))
+			defer srv.Close()
+
+			var path = filepath.Join(t.TempDir(), "f")
+			var opts = append([]Option{WithChunkSize(1000), WithConcurrency(1)}, tt.opts...)
+			var err = DoToFile(ctx, srv.Client(), srv.URL, path, opts...)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, expect the cancellation", err)
+			}
+			if _, err = os.Stat(path); os.IsNotExist(err) == tt.kept {
+				t.Fatalf("partial file kept %v, expect %v", !os.IsNotExist(err), tt.kept)
+			}
+		})
+	}
+}
+
+func TestWithCleanupOnCancelTimeout(t *testing.T) {
+	var data = bytes.Repeat([]byte("cleanup"), 1000)
+	var requests atomic.Int32
+	// the third chunk never comes
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 4 {
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var path = filepath.Join(t.TempDir(), "f")
+	var err = DoToFile(context.Background(), srv.Client(), srv.URL, path,
+		WithChunkSize(1000), WithConcurrency(1), WithTimeout(200*time.Millisecond), WithCleanupOnCancel())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expect the deadline", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("partial file kept: %v", err)
+	}
+}
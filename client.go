@@ -1,7 +1,83 @@
 package httprange
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrRedirectNotAllowed error is returned by the Requester of
+// NewAllowlistRequester for a redirect to a host out of its list.
+var ErrRedirectNotAllowed = errors.New("redirect to a host not allowed")
 
 type Requester interface {
 	Do(r *http.Request) (*http.Response, error)
 }
+
+// NewTunedClient returns an http.Client fit for long parallel downloads.
+// http.Client.Timeout bounds the whole request including the body
+// transfer, so a big chunk on a slow link fails with it. The client has
+// no such timeout, timeout bounds each phase instead: the dial, the TLS
+// handshake and the wait for the response headers. Idle connections are
+// kept for the chunks of the download, up to concurrency per host.
+// Combine it with WithStallTimeout to also bound a stalled body.
+func NewTunedClient(timeout time.Duration, concurrency int) *http.Client {
+	var dialer = &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          concurrency,
+			MaxIdleConnsPerHost:   concurrency,
+		},
+	}
+}
+
+// warnClientTimeout logs a warning if clt is an http.Client with a
+// Timeout, which also applies to reading the body of every chunk.
+func warnClientTimeout(clt Requester, logger Logger) {
+	if hc, ok := clt.(*http.Client); ok && hc.Timeout != 0 {
+		logger.Printf("http.Client.Timeout %v also bounds the body transfer of every chunk, "+
+			"big chunks may fail with it, see NewTunedClient", hc.Timeout)
+	}
+}
+
+// NewAllowlistRequester returns a Requester sending the requests with a
+// copy of inner which only follows redirects to the given hosts, to harden
+// against SSRF through an open redirect. A host is matched without case and
+// without port. The CheckRedirect of inner, if any, still runs for the
+// allowed redirects, otherwise the usual limit of 10 redirects applies.
+// All the requests of the reader and the downloads go through it, the
+// probe included, a rejected redirect fails them with ErrRedirectNotAllowed.
+// The host of the initial URL is not checked.
+func NewAllowlistRequester(inner *http.Client, hosts []string) Requester {
+	var allowed = make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+	var clt = *inner
+	clt.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !allowed[strings.ToLower(req.URL.Hostname())] {
+			return fmt.Errorf("%w: %v", ErrRedirectNotAllowed, req.URL.Host)
+		}
+		if inner.CheckRedirect != nil {
+			return inner.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &clt
+}
@@ -0,0 +1,53 @@
+package httprange
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewAllowlistRequester(t *testing.T) {
+	var data = []byte("redirected")
+	var target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer target.Close()
+	var targetURL, _ = url.Parse(target.URL)
+	// the same server under another host name
+	targetURL.Host = "localhost:" + targetURL.Port()
+	var redirector = httptest.NewServer(http.RedirectHandler(targetURL.String(), http.StatusFound))
+	defer redirector.Close()
+
+	var tests = []struct {
+		name  string
+		hosts []string
+		err   error
+	}{
+		{"allowed", []string{"LOCALHOST"}, nil},
+		{"blocked", []string{"example.com"}, ErrRedirectNotAllowed},
+		{"none allowed", nil, ErrRedirectNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req, _ = http.NewRequest(http.MethodGet, redirector.URL, nil)
+			var ra, err = New(NewAllowlistRequester(redirector.Client(), tt.hosts), req)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, expect %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			var p = make([]byte, len(data))
+			if _, err = ra.ReadAt(p, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p, data) {
+				t.Fatalf("got %q", p)
+			}
+		})
+	}
+}
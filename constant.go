@@ -6,6 +6,10 @@ const (
 	HttpHeaderContentRange       = "Content-Range"
 	HttpHeaderContentDisposition = "Content-Disposition"
 	HttpHeaderContentType        = "Content-Type"
+	HttpHeaderDigest             = "Digest"
+	HttpHeaderReprDigest         = "Repr-Digest"
 
-	HttpHeaderRangeFormat = "bytes=%d-%d"
+	HttpHeaderRangeFormat       = "bytes=%d-%d"
+	HttpHeaderSuffixRangeFormat = "bytes=-%d"
+	HttpHeaderOpenRangeFormat   = "bytes=%d-"
 )
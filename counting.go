@@ -0,0 +1,40 @@
+package httprange
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// CountingReaderAt is an io.ReaderAt decorator counting the bytes and
+// the reads going through it, to instrument any io.ReaderAt pipeline
+// like cache -> counting -> HTTPReaderAt. It is safe for concurrent use
+// if the inner io.ReaderAt is.
+type CountingReaderAt struct {
+	inner io.ReaderAt
+	bytes int64
+	reads int64
+}
+
+var _ io.ReaderAt = (*CountingReaderAt)(nil)
+
+// NewCountingReaderAt returns a CountingReaderAt reading from inner.
+func NewCountingReaderAt(inner io.ReaderAt) *CountingReaderAt {
+	return &CountingReaderAt{inner: inner}
+}
+
+func (c *CountingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var n, err = c.inner.ReadAt(p, off)
+	atomic.AddInt64(&c.reads, 1)
+	atomic.AddInt64(&c.bytes, int64(n))
+	return n, err
+}
+
+// BytesRead returns the number of bytes read so far.
+func (c *CountingReaderAt) BytesRead() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
+// ReadCount returns the number of ReadAt calls so far.
+func (c *CountingReaderAt) ReadCount() int64 {
+	return atomic.LoadInt64(&c.reads)
+}
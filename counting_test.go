@@ -0,0 +1,50 @@
+package httprange
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestCountingReaderAt(t *testing.T) {
+	var data = bytes.Repeat([]byte("count"), 1000)
+	var req, _ = http.NewRequest(http.MethodGet, "http://example.com/f", nil)
+	var ra, err = New(NewFileRequester(data), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c = NewCountingReaderAt(ra)
+
+	const workers, reads = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var p = make([]byte, 10)
+			for j := 0; j < reads; j++ {
+				var off = int64((i*reads + j) * 10 % len(data))
+				if _, err := c.ReadAt(p, off); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := c.ReadCount(); n != workers*reads {
+		t.Fatalf("got %v reads, expect %v", n, workers*reads)
+	}
+	if n := c.BytesRead(); n != workers*reads*10 {
+		t.Fatalf("got %v bytes, expect %v", n, workers*reads*10)
+	}
+
+	// a short read at the end counts the bytes actually read
+	if n, _ := c.ReadAt(make([]byte, 10), int64(len(data)-4)); n != 4 {
+		t.Fatalf("got %v bytes at the end, expect 4", n)
+	}
+	if c.ReadCount() != workers*reads+1 || c.BytesRead() != workers*reads*10+4 {
+		t.Fatalf("got %v reads and %v bytes after the short read", c.ReadCount(), c.BytesRead())
+	}
+}
@@ -0,0 +1,70 @@
+package httprange
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+// DecryptingReaderAt is an io.ReaderAt decorator decrypting an AES-CTR,
+// or any other block cipher in CTR mode, encrypted file on the fly:
+// ReadAt fetches the ciphertext of the asked range from inner and returns
+// the plaintext. CTR is seekable, the keystream at any offset only depends
+// on the block number, so a read needs no other byte than its own range and
+// can start at any offset, without alignment on the cipher block size.
+//
+// The plaintext offset is the ciphertext offset, the counter of the block
+// at offset 0 is iv and it is incremented as a big endian number for every
+// block. Wrap inner in an io.SectionReader to skip a header before the
+// ciphertext. Only CTR is supported: CBC, GCM and the other modes chain the
+// blocks or authenticate the whole message and can't be read at random.
+// It is safe for concurrent use if inner is.
+type DecryptingReaderAt struct {
+	inner io.ReaderAt
+	block cipher.Block
+	iv    []byte
+}
+
+var _ io.ReaderAt = (*DecryptingReaderAt)(nil)
+
+// NewDecryptingReaderAt returns a DecryptingReaderAt reading from inner,
+// iv must have the size of a block.
+func NewDecryptingReaderAt(inner io.ReaderAt, block cipher.Block, iv []byte) (*DecryptingReaderAt, error) {
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("iv length must equal block size")
+	}
+	return &DecryptingReaderAt{
+		inner: inner,
+		block: block,
+		iv:    append([]byte(nil), iv...),
+	}, nil
+}
+
+func (d *DecryptingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	var n, err = d.inner.ReadAt(p, off)
+	if n == 0 {
+		return n, err
+	}
+	var blockSize = int64(d.block.BlockSize())
+	var stream = cipher.NewCTR(d.block, d.counter(off/blockSize))
+	// skip the keystream of the bytes of the first block before off
+	var skip = make([]byte, off%blockSize)
+	stream.XORKeyStream(skip, skip)
+	stream.XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// counter returns the counter of the block number k, iv + k.
+func (d *DecryptingReaderAt) counter(k int64) []byte {
+	var ctr = append([]byte(nil), d.iv...)
+	var carry = uint64(k)
+	for i := len(ctr) - 1; i >= 0 && carry > 0; i-- {
+		var sum = uint64(ctr[i]) + carry&0xff
+		ctr[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	return ctr
+}
@@ -0,0 +1,80 @@
+package httprange
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestDecryptingReaderAt(t *testing.T) {
+	var rnd = rand.New(rand.NewSource(1))
+	var key = make([]byte, 16)
+	rnd.Read(key)
+	var plaintext = make([]byte, 5000)
+	rnd.Read(plaintext)
+	var block, err = aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ivs = map[string][]byte{
+		"random": make([]byte, 16),
+		// the low bytes overflow after a block, the counter must carry
+		"carry": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff},
+		// the whole counter wraps around to zero
+		"wrap": bytes.Repeat([]byte{0xff}, 16),
+	}
+	rnd.Read(ivs["random"])
+	for name, iv := range ivs {
+		var ciphertext = make([]byte, len(plaintext))
+		cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+		var d, err = NewDecryptingReaderAt(bytes.NewReader(ciphertext), block, iv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reads = []struct{ off, n int }{
+			{0, 16},     // a whole block
+			{0, 5000},   // the whole file
+			{3, 7},      // inside a block
+			{13, 10},    // across a block boundary
+			{15, 2},     // the last byte of a block and the first of the next
+			{16, 1},     // the first byte of a block
+			{1001, 999}, // unaligned offset and length over many blocks
+			{4095, 33},
+		}
+		for i := 0; i < 50; i++ {
+			var off = rnd.Intn(len(plaintext))
+			reads = append(reads, struct{ off, n int }{off, 1 + rnd.Intn(len(plaintext)-off)})
+		}
+		for _, r := range reads {
+			var p = make([]byte, r.n)
+			if _, err = d.ReadAt(p, int64(r.off)); err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p, plaintext[r.off:r.off+r.n]) {
+				t.Fatalf("%v iv: read of %v bytes at %v differs", name, r.n, r.off)
+			}
+		}
+	}
+}
+
+func TestDecryptingReaderAtEOF(t *testing.T) {
+	var block, _ = aes.NewCipher(make([]byte, 16))
+	var iv = make([]byte, 16)
+	var plaintext = []byte("short plaintext")
+	var ciphertext = make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+	var d, _ = NewDecryptingReaderAt(bytes.NewReader(ciphertext), block, iv)
+
+	var p = make([]byte, 10)
+	var n, err = d.ReadAt(p, 10)
+	if n != 5 || err != io.EOF || !bytes.Equal(p[:n], plaintext[10:]) {
+		t.Fatalf("got %q, %v, expect the 5 last bytes and io.EOF", p[:n], err)
+	}
+	if _, err = NewDecryptingReaderAt(bytes.NewReader(ciphertext), block, iv[:8]); err == nil {
+		t.Fatal("expect an error for a short iv")
+	}
+}
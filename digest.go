@@ -0,0 +1,163 @@
+package httprange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrDigestMismatch error is returned if the content does not match
+// the digest advertised by the server.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// ErrNotModified error is returned by DoToFile with WithSkipVerified
+// if the existing file already has the content of the remote one.
+var ErrNotModified = errors.New("file not modified")
+
+// WithSkipVerified makes DoToFile hash the existing target file with the
+// algorithm of the digest advertised by the probe response (Repr-Digest or
+// Digest header), and return ErrNotModified without downloading if they
+// match. Unlike an ETag comparison it verifies the actual content.
+// The file is downloaded as usual if the server advertises no digest.
+func WithSkipVerified() Option {
+	return func(c *config) {
+		c.skipVerified = true
+	}
+}
+
+// fileMatchesDigest reports whether the file at path matches the digest of meta.
+func fileMatchesDigest(path string, meta Meta) (bool, error) {
+	var h = newDigestHash(meta.digestAlg)
+	if h == nil {
+		return false, nil
+	}
+	var file, err = os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if _, err = io.Copy(h, file); err != nil {
+		return false, err
+	}
+	return hmac.Equal(h.Sum(nil), meta.digest), nil
+}
+
+// DownloadAny downloads url like Do, and if the server does not support
+// range requests, falls back to a single plain GET of the whole file.
+//
+// On the fallback path the digest advertised by the server in the
+// Repr-Digest or Digest trailer (or header) is verified, trailers are only
+// available there since they follow the body of a full response.
+func DownloadAny(ctx context.Context, clt Requester, url string, opts ...Option) ([]byte, error) {
+	var result, err = Do(ctx, clt, url, opts...)
+	if !errors.Is(err, ErrNoRange) {
+		return result, err
+	}
+	return fetchWhole(ctx, clt, url, newConfig(opts))
+}
+
+// fetchWhole downloads url with a single request without range.
+func fetchWhole(ctx context.Context, clt Requester, url string, cfg *config) ([]byte, error) {
+	var req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.prepare(req); err != nil {
+		return nil, err
+	}
+	cfg.noRange.Store(true)
+	defer cfg.flushStats()
+	var resp *http.Response
+	if resp, err = cfg.requester(clt).Do(req); err != nil {
+		return nil, fmt.Errorf("http request error %w", err)
+	}
+	defer resp.Body.Close()
+	var content []byte
+	defer func() { cfg.stats.record(req, resp, int64(len(content))) }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpect http request : %s, expect %v", resp.Status, http.StatusOK)
+	}
+	if content, err = io.ReadAll(resp.Body); err != nil {
+		return nil, err
+	}
+	// resp.Trailer is only filled once the body is read to the end
+	if err = verifyDigest(resp.Trailer, content); err != nil {
+		return nil, err
+	}
+	if err = verifyDigest(resp.Header, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// verifyDigest checks content against the digest in h, if any.
+func verifyDigest(h http.Header, content []byte) error {
+	var alg, expect, ok = headerDigest(h)
+	if !ok {
+		return nil
+	}
+	var hh = newDigestHash(alg)
+	hh.Write(content)
+	if !hmac.Equal(hh.Sum(nil), expect) {
+		return fmt.Errorf("%w: %s", ErrDigestMismatch, alg)
+	}
+	return nil
+}
+
+// headerDigest returns the first supported digest of h, Repr-Digest first.
+func headerDigest(h http.Header) (alg string, sum []byte, ok bool) {
+	if alg, sum, ok = parseDigest(h.Get(HttpHeaderReprDigest)); ok {
+		return alg, sum, ok
+	}
+	return parseDigest(h.Get(HttpHeaderDigest))
+}
+
+// parseDigest parses a Digest (RFC 3230) or a Repr-Digest (RFC 9530) value:
+// Digest: SHA-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=
+// Repr-Digest: sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:
+// and returns the first digest with a supported algorithm.
+func parseDigest(v string) (alg string, sum []byte, ok bool) {
+	for _, item := range strings.Split(v, ",") {
+		var kv = strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		alg = strings.ToLower(kv[0])
+		if newDigestHash(alg) == nil {
+			continue
+		}
+		var err error
+		if sum, err = base64.StdEncoding.DecodeString(strings.Trim(kv[1], ":")); err != nil {
+			continue
+		}
+		return alg, sum, true
+	}
+	return "", nil, false
+}
+
+// newDigestHash returns the hash of a digest algorithm, nil if unsupported.
+func newDigestHash(alg string) hash.Hash {
+	switch alg {
+	case "sha-256":
+		return sha256.New()
+	case "sha-512":
+		return sha512.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
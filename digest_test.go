@@ -0,0 +1,44 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownloadAnyTrailerDigest(t *testing.T) {
+	var data = bytes.Repeat([]byte("trailer"), 1000)
+	var tests = []struct {
+		name    string
+		content []byte
+		err     error
+	}{
+		{"match", data, nil},
+		{"mismatch", []byte("other content"), ErrDigestMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sum = sha256.Sum256(tt.content)
+			// no range support, the digest follows the body
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", HttpHeaderReprDigest)
+				w.Write(data)
+				w.Header().Set(HttpHeaderReprDigest, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+			}))
+			defer srv.Close()
+
+			var got, err = DownloadAny(context.Background(), srv.Client(), srv.URL)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, expect %v", err, tt.err)
+			}
+			if err == nil && !bytes.Equal(got, data) {
+				t.Fatal("content differs")
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package httprange
+
+import (
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SuggestedFilename returns the file name suggested by the Content-Disposition
+// header of the probe response, its filename* parameter encoded as in
+// RFC 5987 wins over filename. Without one it is the last element of the
+// URL path, "" if neither gives a name. Any directory of the name is
+// dropped, so it is safe to join to a download directory.
+func (ra *HTTPReaderAt) SuggestedFilename() string {
+	if ra.meta.disposition != "" {
+		// mime decodes filename* into filename
+		var _, params, err = mime.ParseMediaType(ra.meta.disposition)
+		if err == nil {
+			if name := cleanFilename(params["filename"]); name != "" {
+				return name
+			}
+		}
+	}
+	if ra.req.URL == nil {
+		return ""
+	}
+	return cleanFilename(path.Base(ra.req.URL.Path))
+}
+
+// cleanFilename keeps the last element of name, "" if it is not a file name.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	switch name {
+	case ".", "..", "/", "":
+		return ""
+	}
+	return name
+}
@@ -1,33 +1,90 @@
 package httprange
 
 import (
+	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
 	"net/http"
 	"os"
-	"time"
+	"sync"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// ErrChecksumMismatch error is returned by DoWithHash, its wrappers and
+// DoToFileWithCheck if the content does not match the expected checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
 // Do 下载支持 Range 下载的文件
-func Do(ctx context.Context, clt Requester, url string) ([]byte, error) {
-	var req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// If the server does not tell the size of the file, the chunks can't be
+// planned and it falls back to a single sequential request.
+func Do(ctx context.Context, clt Requester, url string, opts ...Option) ([]byte, error) {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
 	if err != nil {
 		return nil, err
 	}
-	var preRead *HTTPReaderAt
-	if preRead, err = New(clt, req); err != nil {
+	return download(ctx, preRead, chunkSize)
+}
+
+// DoWithOptions is like Do for a prepared GET request, to download with
+// headers of its own, req is the prototype request of the reader.
+func DoWithOptions(ctx context.Context, clt Requester, req *http.Request, opts ...Option) ([]byte, error) {
+	if req == nil {
+		return nil, errors.New("invalid args")
+	}
+	var preRead, chunkSize, err = probeRequest(clt, req.WithContext(ctx), opts)
+	if err != nil {
 		return nil, err
 	}
+	return download(ctx, preRead, chunkSize)
+}
+
+// download fetches the whole file of preRead in memory.
+func download(ctx context.Context, preRead *HTTPReaderAt, chunkSize int64) ([]byte, error) {
+	var err error
+	var cfg = preRead.cfg
+	defer cfg.flushStats()
+	defer preRead.Close()
 	var totalSize = preRead.Size()
+	if totalSize < 0 {
+		var buf bytes.Buffer
+		if err = readSequential(ctx, preRead, &buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	return downloadRange(ctx, preRead, chunkSize, 0, totalSize)
+}
+
+// readSequential copies the whole file of preRead into w with a single
+// request, there are no chunks without the size. The deadline of WithTimeout
+// bounds it, WithChunkTimeout does not since the request carries the file.
+func readSequential(ctx context.Context, preRead *HTTPReaderAt, w io.Writer) error {
+	var cancel context.CancelFunc
+	ctx, cancel = preRead.cfg.withDeadline(ctx)
+	defer cancel()
+	if _, err := preRead.Clone(ctx).copyFrom(w, 0); err != nil {
+		return err
+	}
+	return preRead.finalValidate(ctx)
+}
 
-	var concurrentCount = 48
-	var buf = make([]byte, totalSize, totalSize)
-	var taskList = makeMemoryTask(totalSize, buf)
+// downloadRange fetches the bytes [start, end) of the file of preRead in memory.
+func downloadRange(ctx context.Context, preRead *HTTPReaderAt, chunkSize, start, end int64) ([]byte, error) {
+	var err error
+	var cfg = preRead.cfg
+	var concurrentCount = cfg.concurrency
+	var buf = make([]byte, end-start)
+	var taskList = makeMemoryTask(start, end, chunkSize, buf)
 	var taskCh = make(chan memoryTaskType, len(taskList))
 	for _, task := range taskList {
 		taskCh <- task
@@ -41,10 +98,11 @@ func Do(ctx context.Context, clt Requester, url string) ([]byte, error) {
 			for task := range taskCh {
 				select {
 				case <-errCtx.Done():
-					return nil
+					// a cancelled download must not look complete
+					return errCtx.Err()
 				default:
 				}
-				if err := readChunk(ctx, preRead, task); err != nil {
+				if err := readChunk(errCtx, preRead, task); err != nil {
 					return err
 				}
 			}
@@ -54,47 +112,332 @@ func Do(ctx context.Context, clt Requester, url string) ([]byte, error) {
 	if err = group.Wait(); err != nil {
 		return nil, err
 	}
+	if err = preRead.finalValidate(ctx); err != nil {
+		return nil, err
+	}
 	return buf, nil
 }
 
-func DoWithCheck(ctx context.Context, clt Requester, url, sha256Sum string) ([]byte, error) {
-	var result, err = Do(ctx, clt, url)
+// DoStreaming downloads url like Do, which also works when the server
+// does not tell the size of the file: it can't be split in chunks then, so
+// the download falls back to a single sequential request of the whole
+// file, an open range bytes=0- answered with 206 or 200, and grows the
+// buffer as the data arrives. A server without range support also gets a
+// plain GET like in DownloadAny. The download stops when ctx is done.
+func DoStreaming(ctx context.Context, clt Requester, url string, opts ...Option) ([]byte, error) {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if errors.Is(err, ErrNoRange) {
+		return fetchWhole(ctx, clt, url, newConfig(opts))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return download(ctx, preRead, chunkSize)
+}
+
+// DoRange downloads the bytes [start, end) of url concurrently, only that
+// window is split in chunks. end is clamped to the size of the file, and
+// it fails with io.EOF if start is at or after the end of the file.
+func DoRange(ctx context.Context, clt Requester, url string, start, end int64, opts ...Option) ([]byte, error) {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
 	if err != nil {
 		return nil, err
 	}
-	if b, _ := equal(result, sha256Sum); !b {
-		return nil, fmt.Errorf("sha256 checksum not equal with %v", sha256Sum)
+	defer preRead.cfg.flushStats()
+	defer preRead.Close()
+	var size = preRead.Size()
+	if size < 0 {
+		return nil, ErrUnknownSize
+	}
+	if start < 0 || start > end {
+		return nil, fmt.Errorf("invalid range %v-%v of size %v", start, end, size)
+	}
+	if start >= size {
+		return nil, io.EOF
+	}
+	if end > size {
+		end = size
+	}
+	preRead.cfg.stats.planChunks(start, end, chunkSize)
+	return downloadRange(ctx, preRead, chunkSize, start, end)
+}
+
+func DoWithCheck(ctx context.Context, clt Requester, url, sha256Sum string, opts ...Option) ([]byte, error) {
+	return DoWithSHA256(ctx, clt, url, sha256Sum, opts...)
+}
+
+// DoWithHash downloads url like Do and verifies the digest of the content
+// computed by h against expected, in constant time. It fails with
+// ErrChecksumMismatch if they differ.
+func DoWithHash(ctx context.Context, clt Requester, url string, h hash.Hash, expected []byte, opts ...Option) ([]byte, error) {
+	var result, err = Do(ctx, clt, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(result)
+	if !hmac.Equal(h.Sum(nil), expected) {
+		return nil, fmt.Errorf("checksum not equal with %x %w", expected, ErrChecksumMismatch)
 	}
 	return result, nil
 }
 
-func DoToFile(ctx context.Context, clt Requester, url, filePath string) error {
-	var req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// DoWithSHA256 is DoWithHash with the hex encoded sha256 checksum sum.
+func DoWithSHA256(ctx context.Context, clt Requester, url, sum string, opts ...Option) ([]byte, error) {
+	return doWithHexSum(ctx, clt, url, sha256.New(), sum, opts)
+}
+
+// DoWithMD5 is DoWithHash with the hex encoded md5 checksum sum.
+func DoWithMD5(ctx context.Context, clt Requester, url, sum string, opts ...Option) ([]byte, error) {
+	return doWithHexSum(ctx, clt, url, md5.New(), sum, opts)
+}
+
+// DoWithCRC32 is DoWithHash with the hex encoded IEEE crc32 checksum sum,
+// as written by the usual tools and carried by the zip entries.
+func DoWithCRC32(ctx context.Context, clt Requester, url, sum string, opts ...Option) ([]byte, error) {
+	return doWithHexSum(ctx, clt, url, crc32.NewIEEE(), sum, opts)
+}
+
+func doWithHexSum(ctx context.Context, clt Requester, url string, h hash.Hash, sum string, opts []Option) ([]byte, error) {
+	var expected, err = hex.DecodeString(sum)
+	if err != nil {
+		return nil, err
+	}
+	return DoWithHash(ctx, clt, url, h, expected, opts...)
+}
+
+func DoToFile(ctx context.Context, clt Requester, url, filePath string, opts ...Option) error {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return err
+	}
+	// writeChunks also closes them, these cover the returns before it
+	defer preRead.cfg.flushStats()
+	defer preRead.Close()
+	if preRead.cfg.skipVerified {
+		var same bool
+		if same, err = fileMatchesDigest(filePath, preRead.meta); err != nil {
+			return err
+		}
+		if same {
+			return ErrNotModified
+		}
+	}
+	var file *os.File
+	if file, err = os.Create(filePath); err != nil {
+		return err
+	}
+	err = writeChunks(ctx, preRead, chunkSize, file)
+	err = preRead.cfg.removeOnCancel(ctx, file, err)
+	return closeFile(file, err)
+}
+
+// closeFile closes a file written by a download which ended with err.
+// After a successful download the file is synced first, so its bytes are
+// on disk when the download returns, and a Sync or Close error is returned.
+func closeFile(file *os.File, err error) error {
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// DoToFileWithProgress is DoToFile with a progress callback, see WithProgress.
+func DoToFileWithProgress(ctx context.Context, clt Requester, url, filePath string,
+	progress func(downloaded, total int64), opts ...Option) error {
+	return DoToFile(ctx, clt, url, filePath, append(opts, WithProgress(progress))...)
+}
+
+// DoToOpenFile downloads url concurrently into f like DoToFile, at the same
+// offsets as in the remote file. The caller owns f: it may be preallocated
+// or sparse, and it is neither closed nor synced, the caller is responsible
+// for Close and Sync.
+func DoToOpenFile(ctx context.Context, clt Requester, url string, f *os.File, opts ...Option) error {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return err
+	}
+	return writeChunks(ctx, preRead, chunkSize, f)
+}
+
+// DoToWriter downloads url concurrently and writes the content to w in
+// order, for sequential sinks like a hash, a compressor or a response.
+// The chunks completed ahead of the next one to write wait in a reorder
+// buffer bounded to 2*concurrency chunks, so a stalled chunk holds the
+// other workers back instead of growing the memory.
+func DoToWriter(ctx context.Context, clt Requester, url string, w io.Writer, opts ...Option) error {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return err
+	}
+	defer preRead.cfg.flushStats()
+	defer preRead.Close()
+	if preRead.Size() < 0 {
+		return readSequential(ctx, preRead, w)
+	}
+	return fetchOrdered(ctx, preRead, makeRangeTask(0, preRead.Size(), chunkSize), w)
+}
+
+// DoToFileWithCheck downloads url to filePath like DoToFile and verifies
+// the sha256 checksum of the content. The chunks are written in order and
+// hashed as soon as the contiguous prefix grows, so the checksum is ready
+// when the last byte arrives instead of taking another pass on the file.
+// The price is the ordered engine of GetReader: a slow chunk holds back
+// the write of the 2*concurrency chunks after it.
+// It fails with ErrChecksumMismatch if the content does not match
+// sha256Sum, the file is then left in place.
+func DoToFileWithCheck(ctx context.Context, clt Requester, url, filePath, sha256Sum string, opts ...Option) error {
+	var expect, err = hex.DecodeString(sha256Sum)
 	if err != nil {
 		return err
 	}
 	var preRead *HTTPReaderAt
-	if preRead, err = New(clt, req); err != nil {
+	var chunkSize int64
+	if preRead, chunkSize, err = probe(ctx, clt, url, opts); err != nil {
 		return err
 	}
-	var totalSize = preRead.Size()
-	var taskCh = makeFileTask(totalSize)
-	var chunkResultCh = make(chan memoryTaskType, len(taskCh))
+	var h = sha256.New()
+	if err = downloadToFile(ctx, preRead, chunkSize, filePath, h); err != nil {
+		return err
+	}
+	if !hmac.Equal(h.Sum(nil), expect) {
+		return fmt.Errorf("sha256 checksum not equal with %v %w", sha256Sum, ErrChecksumMismatch)
+	}
+	return nil
+}
 
-	var file *os.File
-	if file, err = os.Create(filePath); err != nil {
+// downloadToFile fetches the file of preRead in order to filePath,
+// the content is also written to tee.
+func downloadToFile(ctx context.Context, preRead *HTTPReaderAt, chunkSize int64, filePath string, tee io.Writer) error {
+	defer preRead.cfg.flushStats()
+	defer preRead.Close()
+	var file, err = os.Create(filePath)
+	if err != nil {
 		return err
 	}
-	var concurrentCount = 48
+	var w = io.MultiWriter(&atWriter{w: file}, tee)
+	if preRead.Size() < 0 {
+		err = readSequential(ctx, preRead, w)
+	} else {
+		var taskList = makeRangeTask(0, preRead.Size(), chunkSize)
+		err = fetchOrdered(ctx, preRead, taskList, w)
+	}
+	err = preRead.cfg.removeOnCancel(ctx, file, err)
+	return closeFile(file, err)
+}
+
+// atWriter writes sequentially to an io.WriterAt.
+type atWriter struct {
+	w   io.WriterAt
+	off int64
+}
 
+func (a *atWriter) Write(p []byte) (int, error) {
+	var n, err = a.w.WriteAt(p, a.off)
+	a.off += int64(n)
+	return n, err
+}
+
+// Flusher is implemented by the io.WriterAt sinks that buffer writes,
+// see WithFlushEvery.
+type Flusher interface {
+	Flush() error
+}
+
+// DoToWriterAt downloads url concurrently into w, chunks are written
+// in the order they complete. The writes are serialized unless w is an
+// *os.File, so w needs not be safe for concurrent use.
+func DoToWriterAt(ctx context.Context, clt Requester, url string, w io.WriterAt, opts ...Option) error {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return err
+	}
+	return writeChunks(ctx, preRead, chunkSize, w)
+}
+
+// probe creates the reader of url and plans the chunk size of the download.
+func probe(ctx context.Context, clt Requester, url string, opts []Option) (*HTTPReaderAt, int64, error) {
+	var req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return probeRequest(clt, req, opts)
+}
+
+// probeRequest is probe for a prepared request.
+func probeRequest(clt Requester, req *http.Request, opts []Option) (*HTTPReaderAt, int64, error) {
+	var preRead, err = NewWithOptions(clt, req, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var chunkSize int64
+	if chunkSize, err = preRead.cfg.planChunkSize(preRead.Size()); err != nil {
+		return nil, 0, err
+	}
+	preRead.cfg.stats.planChunks(0, preRead.Size(), chunkSize)
+	return preRead, chunkSize, nil
+}
+
+// Chunk is a piece of the file delivered by DoChunks.
+type Chunk struct {
+	Offset int64
+	Data   []byte
+}
+
+// DoChunks downloads url concurrently and delivers the raw chunks on the
+// first channel, for consumers doing the assembly themselves, like an
+// upload to another store. The chunks come in the order they complete, not
+// in the order of the file. The workers wait for the caller to receive a
+// chunk before they fetch the next one, so the caller must consume them
+// promptly or the download stalls.
+// The chunk channel is closed when the download ends, then the error
+// channel receives its result, nil on success, and is closed.
+func DoChunks(ctx context.Context, clt Requester, url string, opts ...Option) (<-chan Chunk, <-chan error) {
+	var chunkCh = make(chan Chunk)
+	var errCh = make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		var err = func() error {
+			defer close(chunkCh)
+			var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+			if err != nil {
+				return err
+			}
+			defer preRead.cfg.flushStats()
+			defer preRead.Close()
+			if err = fetchChunks(ctx, preRead, chunkSize, chunkCh); err != nil {
+				return err
+			}
+			return preRead.finalValidate(ctx)
+		}()
+		errCh <- err
+	}()
+	return chunkCh, errCh
+}
+
+// fetchChunks is the worker pool of the downloads, it sends every chunk
+// of the file to out as soon as it is read.
+func fetchChunks(ctx context.Context, preRead *HTTPReaderAt, chunkSize int64, out chan<- Chunk) error {
+	if preRead.Size() < 0 {
+		return ErrUnknownSize
+	}
+	var tasks = newTaskIter(0, preRead.Size(), chunkSize)
 	var group, errCtx = errgroup.WithContext(ctx)
 
-	for i := 0; i < concurrentCount; i++ {
+	for i := 0; i < preRead.cfg.concurrency; i++ {
 		group.Go(func() error {
-			for task := range taskCh {
+			for {
+				var task, ok = tasks.next()
+				if !ok {
+					return nil
+				}
 				select {
 				case <-errCtx.Done():
-					return nil
+					return errCtx.Err()
 				default:
 				}
 				var mt = memoryTaskType{
@@ -102,107 +445,288 @@ func DoToFile(ctx context.Context, clt Requester, url, filePath string) error {
 					Content: make([]byte, task.Size),
 				}
 
-				if err := readChunk(ctx, preRead, mt); err != nil {
+				if err := readChunk(errCtx, preRead, mt); err != nil {
 					return err
 				}
 				select {
 				case <-errCtx.Done():
-					return nil
-				case chunkResultCh <- mt:
+					return errCtx.Err()
+				case out <- Chunk{Offset: mt.Offset, Data: mt.Content}:
 				}
 			}
-			return nil
 		})
 	}
+	return group.Wait()
+}
+
+// writeChunks downloads the file of preRead into w, every worker writes
+// its chunks itself as soon as they are read, from a buffer reused for the
+// next chunk, so the memory stays around concurrency * chunkSize.
+func writeChunks(ctx context.Context, preRead *HTTPReaderAt, chunkSize int64, w io.WriterAt) error {
+	var cfg = preRead.cfg
+	defer cfg.flushStats()
+	defer preRead.Close()
+	var sink = newSink(w, cfg.flushEvery)
+	if preRead.Size() < 0 {
+		if err := readSequential(ctx, preRead, &atWriter{w: sink}); err != nil {
+			return err
+		}
+		return sink.flush()
+	}
+	var tasks = newTaskIter(0, preRead.Size(), chunkSize)
+	var bufPool = sync.Pool{
+		New: func() any {
+			var buf = make([]byte, chunkSize)
+			return &buf
+		},
+	}
 
-	// single routine for write file
-	group.Go(func() error {
-		var totalWrite int64
-		for {
-			select {
-			case <-errCtx.Done():
-				return nil
-			case chunk := <-chunkResultCh:
-				if _, err := file.WriteAt(chunk.Content, chunk.Offset); err != nil {
+	var group, errCtx = errgroup.WithContext(ctx)
+
+	for i := 0; i < cfg.concurrency; i++ {
+		group.Go(func() error {
+			for {
+				var task, ok = tasks.next()
+				if !ok {
+					return nil
+				}
+				if err := errCtx.Err(); err != nil {
 					return err
 				}
-				totalWrite += int64(len(chunk.Content))
-				if totalWrite == totalSize {
-					return nil
+				var buf = bufPool.Get().(*[]byte)
+				var mt = memoryTaskType{
+					Offset:  task.Offset,
+					Content: (*buf)[:task.Size],
+				}
+				var err = readChunk(errCtx, preRead, mt)
+				if err == nil {
+					err = sink.writeAt(mt.Content, mt.Offset)
+				}
+				bufPool.Put(buf)
+				if err != nil {
+					return err
 				}
 			}
-		}
-	})
-	return group.Wait()
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	if err := sink.flush(); err != nil {
+		return err
+	}
+	return preRead.finalValidate(ctx)
+}
+
+// sink is the io.WriterAt of writeChunks. An *os.File is written
+// concurrently, the other writers may not be safe for concurrent use and
+// their WriteAt and Flush calls are serialized.
+type sink struct {
+	w          io.WriterAt
+	mu         *sync.Mutex
+	flusher    Flusher
+	flushEvery int64
+	unflushed  int64
+}
+
+func newSink(w io.WriterAt, flushEvery int64) *sink {
+	var s = &sink{w: w, flushEvery: flushEvery}
+	if _, ok := w.(*os.File); !ok {
+		s.mu = &sync.Mutex{}
+	}
+	if flusher, ok := w.(Flusher); ok && flushEvery > 0 {
+		s.flusher = flusher
+	}
+	return s
+}
+
+// writeAt writes p at off and flushes the writer every flushEvery bytes.
+func (s *sink) writeAt(p []byte, off int64) error {
+	if s.mu == nil {
+		var _, err = s.w.WriteAt(p, off)
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.WriteAt(p, off); err != nil {
+		return err
+	}
+	s.unflushed += int64(len(p))
+	if s.flusher != nil && s.unflushed >= s.flushEvery {
+		s.unflushed = 0
+		return s.flusher.Flush()
+	}
+	return nil
+}
+
+func (s *sink) WriteAt(p []byte, off int64) (int, error) {
+	if err := s.writeAt(p, off); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
-func makeFileTask(totalSize int64) <-chan fileTaskType {
-	const chunkSize int64 = 64 * 1024
-	var taskCount = totalSize / chunkSize
-	var taskList = make([]fileTaskType, taskCount)
-	var offset int64 = 0
-	for i := int64(0); i < taskCount; i++ {
-		taskList[i].Offset = offset
-		taskList[i].Size = chunkSize
-		offset += chunkSize
+// flush flushes the writer once the download completed.
+func (s *sink) flush() error {
+	if s.flusher == nil {
+		return nil
 	}
-	if offset < totalSize {
+	return s.flusher.Flush()
+}
+
+// taskIter hands out the chunks of [start, end) one at a time,
+// instead of building the list of all of them up front.
+type taskIter struct {
+	mu        sync.Mutex
+	offset    int64
+	end       int64
+	chunkSize int64
+}
+
+func newTaskIter(start, end, chunkSize int64) *taskIter {
+	return &taskIter{offset: start, end: end, chunkSize: chunkSize}
+}
+
+// next returns the next chunk, false when all the chunks were handed out.
+func (t *taskIter) next() (fileTaskType, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.offset >= t.end {
+		return fileTaskType{}, false
+	}
+	var task = fileTaskType{Offset: t.offset, Size: t.chunkSize}
+	if task.Offset+task.Size > t.end {
+		task.Size = t.end - task.Offset
+	}
+	t.offset += task.Size
+	return task, true
+}
+
+// makeRangeTask splits [start, end) in chunks of chunkSize, the last one may be shorter.
+func makeRangeTask(start, end, chunkSize int64) []fileTaskType {
+	var taskList = make([]fileTaskType, 0, chunkCount(end-start, chunkSize))
+	for offset := start; offset < end; offset += chunkSize {
+		var size = chunkSize
+		if offset+size > end {
+			size = end - offset
+		}
 		taskList = append(taskList, fileTaskType{
 			Offset: offset,
-			Size:   totalSize - offset,
+			Size:   size,
 		})
 	}
-	var taskCh = make(chan fileTaskType, len(taskList))
-	for _, e := range taskList {
-		taskCh <- e
-	}
-	close(taskCh)
-	return taskCh
+	return taskList
 }
 
-func equal(content []byte, checksum string) (bool, error) {
-	expect, err := hex.DecodeString(checksum)
-	if err != nil {
-		return false, err
-	}
-	v1 := sha256.Sum256(content)
-	return hmac.Equal(v1[:], expect), nil
+// ChunkError error is returned by the downloads if a chunk failed after
+// its retries, it tells the range of the chunk so a caller can fetch it
+// again, with ReadRange for example.
+type ChunkError struct {
+	Offset int64
+	Size   int
+	Err    error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk(offset %v size %v) %v", e.Offset, e.Size, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
 }
 
+// readChunk reads the chunk of task, the failed attempts are retried
+// as configured by WithMaxRetries, WithRetryPredicate and WithAllowReplay.
+// Its failure is a *ChunkError.
 func readChunk(ctx context.Context, preReader *HTTPReaderAt, task memoryTaskType) error {
-	// a chunk should done in 1 minutes
+	if err := retryChunk(ctx, preReader, task); err != nil {
+		return &ChunkError{Offset: task.Offset, Size: len(task.Content), Err: err}
+	}
+	return nil
+}
+
+func retryChunk(ctx context.Context, preReader *HTTPReaderAt, task memoryTaskType) error {
+	var cfg = preReader.cfg
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, time.Minute)
+	ctx, cancel = cfg.withDeadline(ctx)
 	defer cancel()
-	var chunkReader = preReader.Clone(ctx)
-	var n, err = chunkReader.ReadAt(task.Content, task.Offset)
-	if err != nil {
+	var req *http.Request
+	for attempt := 0; ; attempt++ {
+		var err error
+		// a provided URL or a signature may have expired since
+		if req == nil || !cfg.replayable() {
+			if req, err = preReader.newRequest(); err != nil {
+				return err
+			}
+		}
+		if preReader.rangeLost.Load() {
+			// another chunk got the whole file, fail fast like it did
+			return fmt.Errorf("server stopped answering range requests %w", ErrNoRange)
+		}
+		if err = cfg.throttle.acquire(ctx); err != nil {
+			return err
+		}
+		err = readChunkOnce(ctx, preReader, req, task)
+		cfg.stats.recordAttempts(task.Offset, attempt+1)
+		if err == nil && cfg.progress != nil {
+			cfg.progress(cfg.downloaded.Add(int64(len(task.Content))), preReader.Size())
+		}
+		cfg.throttle.release(err)
+		if err != nil {
+			cfg.noteFailure(err)
+		}
+		if err == nil || attempt >= cfg.maxRetries || ctx.Err() != nil || errors.Is(err, ErrNoRange) {
+			return err
+		}
+		var retry, after = cfg.shouldRetry(ctx, err, attempt)
+		if !retry || !sleepContext(ctx, after) {
+			return err
+		}
+	}
+}
+
+func readChunkOnce(ctx context.Context, preReader *HTTPReaderAt, req *http.Request, task memoryTaskType) error {
+	// a chunk should done in WithChunkTimeout, or in the time left by
+	// WithTimeout since the deadline of ctx is kept if it is earlier
+	var chunkCtx = ctx
+	if timeout := preReader.cfg.chunkTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		chunkCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	chunkCtx = withChunkInfo(chunkCtx, task.Offset, int64(len(task.Content)))
+	var n, err = preReader.readAt(req.WithContext(chunkCtx), task.Content, task.Offset)
+	if err != nil && chunkCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return fmt.Errorf("timeout after %v %w", preReader.cfg.chunkTimeout, context.DeadlineExceeded)
+	}
+	return checkChunk(task, n, err)
+}
+
+// checkChunk turns the result of reading task into its error, a short read
+// is always a hard error, or the output would have a gap.
+func checkChunk(task memoryTaskType, n int, err error) error {
+	if err == io.EOF && n == len(task.Content) {
+		// the chunk ends at the end of file
+		err = nil
+	}
+	if err != nil && err != io.EOF {
 		return err
 	}
 	if n != len(task.Content) {
-		return fmt.Errorf("download size %v not equal with expect size %v, for task(offset %v size %v)",
-			n, len(task.Content), task.Offset, len(task.Content))
+		return fmt.Errorf("download size %v not equal with expect size %v %w",
+			n, len(task.Content), io.ErrUnexpectedEOF)
 	}
 	return nil
 }
 
-func makeMemoryTask(totalSize int64, buf []byte) []memoryTaskType {
-	var chunkSize int64 = 64 * 1024
-	var taskList []memoryTaskType
-
-	var taskCount = totalSize / chunkSize
-	taskList = make([]memoryTaskType, taskCount, taskCount+1)
-	var offset int64 = 0
-	for i := int64(0); i < taskCount; i++ {
-		taskList[i].Offset = offset
-		taskList[i].Content = buf[offset : offset+chunkSize]
-		offset += chunkSize
-	}
-	if offset < totalSize {
-		taskList = append(taskList, memoryTaskType{
-			Offset:  offset,
-			Content: buf[offset:totalSize],
-		})
+// makeMemoryTask splits [start, end) in chunks of chunkSize read into
+// buf, which holds the bytes of the range.
+func makeMemoryTask(start, end, chunkSize int64, buf []byte) []memoryTaskType {
+	var fileTasks = makeRangeTask(start, end, chunkSize)
+	var taskList = make([]memoryTaskType, len(fileTasks))
+	for i, task := range fileTasks {
+		taskList[i].Offset = task.Offset
+		taskList[i].Content = buf[task.Offset-start : task.Offset-start+task.Size]
 	}
 	return taskList
 }
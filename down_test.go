@@ -0,0 +1,305 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoToFileClosesStore(t *testing.T) {
+	var data = []byte("stored in a temporary file")
+	var sum = sha256.Sum256(data)
+	// no range support, the probe response is kept in the store
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HttpHeaderReprDigest, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		w.Write(data)
+	}))
+	defer srv.Close()
+	var ctx = context.Background()
+
+	var storeDir = t.TempDir()
+	var outDir = t.TempDir()
+	var assertNoTemp = func(t *testing.T) {
+		t.Helper()
+		var entries, _ = os.ReadDir(storeDir)
+		if len(entries) != 0 {
+			t.Fatalf("temporary file leaked: %v", entries[0].Name())
+		}
+	}
+
+	t.Run("create error", func(t *testing.T) {
+		var path = filepath.Join(outDir, "missing", "f")
+		if err := DoToFile(ctx, srv.Client(), srv.URL, path, WithStore(TempFileStore(storeDir))); err == nil {
+			t.Fatal("expect the create error")
+		}
+		assertNoTemp(t)
+	})
+	t.Run("not modified", func(t *testing.T) {
+		var path = filepath.Join(outDir, "f")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var err = DoToFile(ctx, srv.Client(), srv.URL, path, WithStore(TempFileStore(storeDir)), WithSkipVerified())
+		if !errors.Is(err, ErrNotModified) {
+			t.Fatalf("got %v, expect ErrNotModified", err)
+		}
+		assertNoTemp(t)
+	})
+	t.Run("download", func(t *testing.T) {
+		var path = filepath.Join(outDir, "g")
+		if err := DoToFile(ctx, srv.Client(), srv.URL, path, WithStore(TempFileStore(storeDir))); err != nil {
+			t.Fatal(err)
+		}
+		var content, _ = os.ReadFile(path)
+		if !bytes.Equal(content, data) {
+			t.Fatalf("got %q", content)
+		}
+		assertNoTemp(t)
+	})
+}
+
+func TestDoWithOptionsNilRequest(t *testing.T) {
+	if _, err := DoWithOptions(context.Background(), NewFileRequester(nil), nil); err == nil {
+		t.Fatal("expect an error for a nil request")
+	}
+}
+
+// recordingSink is a buffering io.WriterAt recording the bytes written
+// between two Flush calls.
+type recordingSink struct {
+	buf     []byte
+	pending int
+	flushes []int
+}
+
+func (s *recordingSink) WriteAt(p []byte, off int64) (int, error) {
+	copy(s.buf[off:], p)
+	s.pending += len(p)
+	return len(p), nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.flushes = append(s.flushes, s.pending)
+	s.pending = 0
+	return nil
+}
+
+func TestWithFlushEvery(t *testing.T) {
+	var data = bytes.Repeat([]byte("flush cadence"), 1000)
+	var clt = NewFileRequester(data[:10000])
+	var tests = []struct {
+		opts    []Option
+		flushes []int
+	}{
+		{nil, nil},
+		// every 3 chunks, then the rest when the download completes
+		{[]Option{WithFlushEvery(2500)}, []int{3000, 3000, 3000, 1000}},
+		{[]Option{WithFlushEvery(1000)}, []int{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 0}},
+	}
+	for _, tt := range tests {
+		var sink = &recordingSink{buf: make([]byte, 10000)}
+		var opts = append([]Option{WithChunkSize(1000), WithConcurrency(1)}, tt.opts...)
+		if err := DoToWriterAt(context.Background(), clt, "http://example.com/f", sink, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sink.buf, data[:10000]) {
+			t.Fatal("content differs")
+		}
+		if fmt.Sprint(sink.flushes) != fmt.Sprint(tt.flushes) {
+			t.Errorf("got flushes %v, expect %v", sink.flushes, tt.flushes)
+		}
+	}
+}
+
+func TestCheckChunk(t *testing.T) {
+	var task = memoryTaskType{Offset: 3000, Content: make([]byte, 1000)}
+	var tests = []struct {
+		n   int
+		err error
+		ok  bool
+	}{
+		{1000, nil, true},
+		{1000, io.EOF, true},
+		{999, nil, false},
+		{999, io.EOF, false},
+		{0, nil, false},
+		{1000, errInjected, false},
+	}
+	for _, tt := range tests {
+		if err := checkChunk(task, tt.n, tt.err); (err == nil) != tt.ok {
+			t.Errorf("n %v err %v: got %v, expect ok %v", tt.n, tt.err, err, tt.ok)
+		}
+	}
+}
+
+func TestDoShortChunk(t *testing.T) {
+	var data = bytes.Repeat([]byte("0123456789"), 1000)
+	// the body of the chunk at 3000 is one byte short of its headers
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HttpHeaderRange) == "bytes=3000-3999" {
+			w.Header().Set(HttpHeaderContentRange, fmt.Sprintf("bytes 3000-3999/%v", len(data)))
+			w.Header().Set("Content-Length", "1000")
+			w.Header().Set("Last-Modified", time.Unix(1, 0).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[3000:3999])
+			return
+		}
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var _, err = Do(context.Background(), srv.Client(), srv.URL, WithChunkSize(1000), WithMaxRetries(0))
+	var chunkErr *ChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Offset != 3000 || chunkErr.Size != 1000 ||
+		!errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, expect the short read of the chunk at 3000", err)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	var srv = newFileServer(nil)
+	defer srv.Close()
+	// a deadlock fails with the deadline instead of hanging
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, clt := range []Requester{srv.Client(), NewFileRequester(nil)} {
+		var path = filepath.Join(t.TempDir(), "f")
+		if err := DoToFile(ctx, clt, srv.URL, path); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+			t.Fatalf("got %v, %v, expect an empty file", info, err)
+		}
+		if got, err := Do(ctx, clt, srv.URL); err != nil || len(got) != 0 {
+			t.Fatalf("Do got %v bytes, %v", len(got), err)
+		}
+		var r, err = GetReader(ctx, clt, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || len(got) != 0 {
+			t.Fatalf("GetReader got %v bytes, %v", len(got), err)
+		}
+		r.Close()
+	}
+}
+
+func TestDoCancelMidway(t *testing.T) {
+	var data = bytes.Repeat([]byte("cancel"), 10000)
+	var path = filepath.Join(t.TempDir(), "f")
+	var downloads = map[string]func(ctx context.Context, clt Requester, url string, opts ...Option) error{
+		"Do": func(ctx context.Context, clt Requester, url string, opts ...Option) error {
+			var _, err = Do(ctx, clt, url, opts...)
+			return err
+		},
+		"DoToFile": func(ctx context.Context, clt Requester, url string, opts ...Option) error {
+			return DoToFile(ctx, clt, url, path, opts...)
+		},
+	}
+	for name, download := range downloads {
+		for _, concurrency := range []int{1, 4} {
+			var ctx, cancel = context.WithCancel(context.Background())
+			var requests atomic.Int32
+			// the chunk canceling the download is still served in full
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 5 {
+					cancel()
+				}
+				http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+			}))
+			var err = download(ctx, srv.Client(), srv.URL, WithChunkSize(1000), WithConcurrency(concurrency))
+			srv.Close()
+			cancel()
+			if err == nil {
+				t.Fatalf("%v with concurrency %v: a canceled download returned no error", name, concurrency)
+			}
+		}
+	}
+}
+
+func TestUnknownSizeTimeout(t *testing.T) {
+	// the probe gets a range without the length of the file, the
+	// sequential read of the whole file then stalls after a few bytes
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HttpHeaderContentRange, "bytes 0-0/*")
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Header.Get(HttpHeaderRange) == "bytes=0-0" {
+			w.Write([]byte("a"))
+			return
+		}
+		w.Write([]byte("abc"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	var dir = t.TempDir()
+	var downloads = map[string]func(ctx context.Context, opts ...Option) error{
+		"Do": func(ctx context.Context, opts ...Option) error {
+			var _, err = Do(ctx, srv.Client(), srv.URL, opts...)
+			return err
+		},
+		"DoToWriter": func(ctx context.Context, opts ...Option) error {
+			return DoToWriter(ctx, srv.Client(), srv.URL, io.Discard, opts...)
+		},
+		"DoToFileWithCheck": func(ctx context.Context, opts ...Option) error {
+			return DoToFileWithCheck(ctx, srv.Client(), srv.URL, filepath.Join(dir, "a"), "", opts...)
+		},
+		"DoToFile": func(ctx context.Context, opts ...Option) error {
+			return DoToFile(ctx, srv.Client(), srv.URL, filepath.Join(dir, "b"), opts...)
+		},
+	}
+	for name, download := range downloads {
+		var start = time.Now()
+		var err = download(context.Background(), WithTimeout(200*time.Millisecond))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%v: got %v, expect the deadline", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Fatalf("%v: took %v", name, elapsed)
+		}
+	}
+}
+
+// latencyRequester is a Requester adding a round trip time to every request.
+type latencyRequester struct {
+	Requester
+	latency time.Duration
+}
+
+func (l latencyRequester) Do(req *http.Request) (*http.Response, error) {
+	time.Sleep(l.latency)
+	return l.Requester.Do(req)
+}
+
+func BenchmarkChunkSize(b *testing.B) {
+	var data = make([]byte, 16<<20)
+	var clt = latencyRequester{Requester: NewFileRequester(data), latency: 20 * time.Millisecond}
+	for _, size := range []int64{64 << 10, 4 << 20} {
+		b.Run(fmt.Sprintf("%vKiB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := Do(context.Background(), clt, "http://example.com/f", WithChunkSize(size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newFileServer serves data with range support.
+func newFileServer(data []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+}
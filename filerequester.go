@@ -0,0 +1,119 @@
+package httprange
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewFileRequester returns a Requester serving data for any URL, without
+// network, for the tests of code built on the package. It answers a single
+// range, bytes=first-last, bytes=first- or the suffix bytes=-n, with 206
+// and Content-Range, a range past the end of data with 416, and a request
+// without range, or with one it can't parse, with 200 and the whole data.
+// The responses carry Accept-Ranges, an ETag of data and a fixed
+// Last-Modified, a HEAD gets the headers of the GET without body.
+func NewFileRequester(data []byte) Requester {
+	return &fileRequester{data: data, ranges: true}
+}
+
+// NewNoRangeRequester returns a Requester like NewFileRequester which
+// ignores the Range header, it always answers 200 with the whole data,
+// for the fallback paths of servers without range support.
+func NewNoRangeRequester(data []byte) Requester {
+	return &fileRequester{data: data}
+}
+
+type fileRequester struct {
+	data   []byte
+	ranges bool
+}
+
+func (f *fileRequester) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	var size = int64(len(f.data))
+	var resp = &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	resp.Header.Set("ETag", fmt.Sprintf(`"%08x"`, crc32.ChecksumIEEE(f.data)))
+	resp.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	resp.Header.Set(HttpHeaderContentType, "application/octet-stream")
+	if f.ranges {
+		resp.Header.Set("Accept-Ranges", "bytes")
+	} else {
+		resp.Header.Set("Accept-Ranges", "none")
+	}
+
+	var body = f.data
+	resp.StatusCode = http.StatusOK
+	if first, last, ok := parseRange(req.Header.Get(HttpHeaderRange), size); f.ranges && ok {
+		if first >= size {
+			resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+			resp.Header.Set(HttpHeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			body = nil
+		} else {
+			if last >= size {
+				last = size - 1
+			}
+			resp.StatusCode = http.StatusPartialContent
+			resp.Header.Set(HttpHeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", first, last, size))
+			body = f.data[first : last+1]
+		}
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set(HttpHeaderContentLength, strconv.Itoa(len(body)))
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// parseRange parses a single range of a Range header for a file of size
+// bytes, a suffix range is turned into its offsets.
+func parseRange(header string, size int64) (first, last int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, false
+	}
+	var spec = strings.TrimPrefix(header, "bytes=")
+	if strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	var a, b, dash = strings.Cut(spec, "-")
+	if !dash {
+		return 0, 0, false
+	}
+	var err error
+	if a == "" {
+		var n int64
+		if n, err = parseUint(b); err != nil || n == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		// for an empty file first is size, a 416
+		return size - n, size - 1, true
+	}
+	if first, err = parseUint(a); err != nil {
+		return 0, 0, false
+	}
+	if b == "" {
+		return first, size - 1, true
+	}
+	if last, err = parseUint(b); err != nil || first > last {
+		return 0, 0, false
+	}
+	return first, last, true
+}
@@ -0,0 +1,41 @@
+package httprange
+
+import "sync"
+
+// WithProbeSize makes the probe request of New ask for the first n bytes
+// of the file instead of a single one, and keeps them for the first read.
+// The first ReadAt, or download chunk, within [0, n) is then served
+// without any request, for formats reading a header right after the open.
+// The bytes are dropped after that read to free the memory, the next reads
+// of the range make requests as usual. Set n to the size of the header,
+// a chunk going past n is not served from the kept bytes.
+func WithProbeSize(n int64) Option {
+	return func(c *config) {
+		c.probeSize = n
+	}
+}
+
+// headCache holds the bytes of the probe for a single read.
+type headCache struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (h *headCache) keep(buf []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf = buf
+}
+
+// take copies the kept bytes at off into p and drops them, it reports
+// false and keeps them if they don't cover all of p.
+func (h *headCache) take(p []byte, off int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.buf == nil || off < 0 || off+int64(len(p)) > int64(len(h.buf)) {
+		return false
+	}
+	copy(p, h.buf[off:])
+	h.buf = nil
+	return true
+}
@@ -0,0 +1,58 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithProbeSize(t *testing.T) {
+	var data = bytes.Repeat([]byte("header"), 1000)
+	var requests atomic.Int32
+	var srv = newCountingServer(data, &requests)
+	defer srv.Close()
+
+	var req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	var ra, err = NewWithOptions(srv.Client(), req, WithProbeSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p = make([]byte, 100)
+	if _, err = ra.ReadAt(p, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, data[10:110]) {
+		t.Fatal("content differs")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("got %v requests, expect only the probe", n)
+	}
+	// the kept bytes are dropped after the first read
+	if _, err = ra.ReadAt(p, 10); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("got %v requests, expect 2", n)
+	}
+}
+
+func TestWithProbeSizeDownload(t *testing.T) {
+	var data = bytes.Repeat([]byte("header"), 1000)
+	var requests atomic.Int32
+	var srv = newCountingServer(data, &requests)
+	defer srv.Close()
+
+	var got, err = Do(context.Background(), srv.Client(), srv.URL, WithProbeSize(1000), WithChunkSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("content differs")
+	}
+	// the probe serves the first chunk
+	if n := requests.Load(); n != 6 {
+		t.Fatalf("got %v requests, expect the probe and 5 chunks", n)
+	}
+}
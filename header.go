@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 var errParse = errors.New("content-range parse error")
@@ -16,36 +17,47 @@ var errParse = errors.New("content-range parse error")
 // simple parse is better than regex:
 // regexp.MustCompile(`bytes ([0-9]+)-([0-9]+)/([0-9]+|\\*)`)
 // regex not supprt format of bytes */1234
+// It rejects the values no server should send: signed numbers,
+// a range ending before it starts or past the end of the file.
+// Whitespace around the fields and the case of the unit are tolerated,
+// like in "Bytes  42-1233/1234".
 func parseContentRange(str string) (first, last, length int64, err error) {
 	first, last, length = -1, -1, -1
 
-	var strList = strings.Split(str, " ")
-	if len(strList) != 2 || strList[0] != "bytes" {
+	// the unit is case insensitive and some servers pad with spaces,
+	// the whitespace around the unit, "/" and "-" is dropped, not the one
+	// inside a number
+	str = strings.TrimSpace(str)
+	var sep = strings.IndexFunc(str, unicode.IsSpace)
+	if sep < 0 || !strings.EqualFold(str[:sep], "bytes") {
 		return -1, -1, -1, errParse
 	}
-	strList = strings.Split(strList[1], "/")
+	var strList = splitTrim(str[sep:], "/")
 	if len(strList) != 2 {
 		return -1, -1, -1, errParse
 	}
 	if strList[1] != "*" {
-		length, err = strconv.ParseInt(strList[1], 10, 64)
+		length, err = parseUint(strList[1])
 		if err != nil {
 			return -1, -1, -1, errParse
 		}
 	}
 	if strList[0] != "*" {
-		strList = strings.Split(strList[0], "-")
+		strList = splitTrim(strList[0], "-")
 		if len(strList) != 2 {
 			return -1, -1, -1, errParse
 		}
-		first, err = strconv.ParseInt(strList[0], 10, 64)
+		first, err = parseUint(strList[0])
 		if err != nil {
 			return -1, -1, -1, errParse
 		}
-		last, err = strconv.ParseInt(strList[1], 10, 64)
+		last, err = parseUint(strList[1])
 		if err != nil {
 			return -1, -1, -1, errParse
 		}
+		if first > last || (length != -1 && last >= length) {
+			return -1, -1, -1, errParse
+		}
 	}
 	if first == -1 && last == -1 && length == -1 {
 		return -1, -1, -1, errParse
@@ -53,6 +65,38 @@ func parseContentRange(str string) (first, last, length int64, err error) {
 	return first, last, length, nil
 }
 
+// splitTrim splits s around sep and trims the whitespace of the parts.
+func splitTrim(s, sep string) []string {
+	var parts = strings.Split(s, sep)
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// ParseContentRange parses the value of a Content-Range header, see
+// parseContentRange. first and last are -1 for "bytes */length",
+// length is -1 for an unknown one.
+func ParseContentRange(str string) (first, last, length int64, err error) {
+	return parseContentRange(str)
+}
+
+// parseUint parses a non negative decimal number made of digits only,
+// strconv.ParseInt alone would accept a sign.
+func parseUint(s string) (int64, error) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return -1, errParse
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// weakETagEqual compares two ETags with the weak comparison of RFC 7232,
+// W/"abc" matches "abc", some proxies flip between the two forms of the
+// same entity.
+func weakETagEqual(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
 func cloneHeader(h http.Header) http.Header {
 	h2 := make(http.Header, len(h))
 	for k, vv := range h {
@@ -63,6 +107,7 @@ func cloneHeader(h http.Header) http.Header {
 	return h2
 }
 
+// Meta is the metadata of the file parsed from a response.
 type Meta struct {
 	start        int64
 	end          int64
@@ -70,6 +115,51 @@ type Meta struct {
 	lastModified string
 	etag         string
 	contentType  string
+	acceptRanges string
+	disposition  string
+	// digestAlg and digest are the Repr-Digest or Digest of the file
+	digestAlg string
+	digest    []byte
+}
+
+// Start is the first byte of the range in the response, -1 if none.
+func (m Meta) Start() int64 {
+	return m.start
+}
+
+// End is the last byte, inclusive, of the range in the response, -1 if none.
+func (m Meta) End() int64 {
+	return m.end
+}
+
+// Size is the size of the whole file, -1 if unknown.
+func (m Meta) Size() int64 {
+	return m.size
+}
+
+func (m Meta) LastModified() string {
+	return m.lastModified
+}
+
+func (m Meta) ETag() string {
+	return m.etag
+}
+
+func (m Meta) ContentType() string {
+	return m.contentType
+}
+
+func (m Meta) AcceptRanges() string {
+	return m.acceptRanges
+}
+
+func (m Meta) ContentDisposition() string {
+	return m.disposition
+}
+
+// ParseMeta returns the metadata of a 200 or 206 response.
+func ParseMeta(resp *http.Response) (Meta, error) {
+	return getMeta(resp)
 }
 
 func getMeta(resp *http.Response) (Meta, error) {
@@ -80,7 +170,10 @@ func getMeta(resp *http.Response) (Meta, error) {
 		lastModified: resp.Header.Get("Last-Modified"),
 		etag:         resp.Header.Get("ETag"),
 		contentType:  resp.Header.Get(HttpHeaderContentType),
+		acceptRanges: resp.Header.Get("Accept-Ranges"),
+		disposition:  resp.Header.Get(HttpHeaderContentDisposition),
 	}
+	meta.digestAlg, meta.digest, _ = headerDigest(resp.Header)
 	switch resp.StatusCode {
 	case http.StatusOK:
 		meta.size = resp.ContentLength
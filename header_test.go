@@ -0,0 +1,121 @@
+package httprange
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	var tests = []struct {
+		in                  string
+		first, last, length int64
+		ok                  bool
+	}{
+		{"bytes 42-1233/1234", 42, 1233, 1234, true},
+		{"bytes */1234", -1, -1, 1234, true},
+		{"bytes 42-1233/*", 42, 1233, -1, true},
+		{"bytes 0-0/1", 0, 0, 1, true},
+		// extra whitespace and case
+		{"bytes  42-1233/1234", 42, 1233, 1234, true},
+		{"  Bytes 42-1233/1234 ", 42, 1233, 1234, true},
+		{"BYTES\t42 - 1233 / 1234", 42, 1233, 1234, true},
+		{"bytes * / 1234", -1, -1, 1234, true},
+		// garbage
+		{"", -1, -1, -1, false},
+		{"bytes", -1, -1, -1, false},
+		{"bytes42-1233/1234", -1, -1, -1, false},
+		{"bits 42-1233/1234", -1, -1, -1, false},
+		{"bytes */*", -1, -1, -1, false},
+		{"bytes 42-1233", -1, -1, -1, false},
+		{"bytes 42/1234", -1, -1, -1, false},
+		{"bytes 1-2-3/1234", -1, -1, -1, false},
+		{"bytes a-b/c", -1, -1, -1, false},
+		{"bytes 1 0-20/30", -1, -1, -1, false},
+		{"bytes 10-2 0/30", -1, -1, -1, false},
+		{"bytes 10-20/3 0", -1, -1, -1, false},
+		{"bytes +1-20/30", -1, -1, -1, false},
+		{"bytes -1-20/30", -1, -1, -1, false},
+		{"bytes 20-10/30", -1, -1, -1, false},
+		{"bytes 10-30/30", -1, -1, -1, false},
+	}
+	for _, tt := range tests {
+		var first, last, length, err = parseContentRange(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: err %v, expect ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if first != tt.first || last != tt.last || length != tt.length {
+			t.Errorf("%q: got %v-%v/%v, expect %v-%v/%v",
+				tt.in, first, last, length, tt.first, tt.last, tt.length)
+		}
+	}
+}
+
+// formatContentRange is the reference formatter of a Content-Range value.
+func formatContentRange(first, last, length int64) string {
+	var size = "*"
+	if length != -1 {
+		size = fmt.Sprint(length)
+	}
+	if first == -1 {
+		return "bytes */" + size
+	}
+	return fmt.Sprintf("bytes %d-%d/%s", first, last, size)
+}
+
+func FuzzParseContentRange(f *testing.F) {
+	for _, seed := range []string{
+		"bytes 42-1233/1234",
+		"bytes */1234",
+		"bytes 42-1233/*",
+		"Bytes  0-0 / 1",
+		"bytes 1 0-20/30",
+		"bytes -1-2/3",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		var first, last, length, err = parseContentRange(in)
+		if err != nil {
+			if first != -1 || last != -1 || length != -1 {
+				t.Fatalf("%q: failed parse returned %v-%v/%v", in, first, last, length)
+			}
+			return
+		}
+		if (first == -1) != (last == -1) || (first == -1 && length == -1) {
+			t.Fatalf("%q: inconsistent %v-%v/%v", in, first, last, length)
+		}
+		if first > last || (length != -1 && last >= length) {
+			t.Fatalf("%q: invalid range %v-%v/%v", in, first, last, length)
+		}
+		var out = formatContentRange(first, last, length)
+		var first2, last2, length2, err2 = parseContentRange(out)
+		if err2 != nil || first2 != first || last2 != last || length2 != length {
+			t.Fatalf("%q: round trip through %q gave %v-%v/%v %v",
+				in, out, first2, last2, length2, err2)
+		}
+	})
+}
+
+func TestWeakETagEqual(t *testing.T) {
+	var tests = []struct {
+		a, b  string
+		equal bool
+	}{
+		{`"abc"`, `"abc"`, true},
+		{`"abc"`, `W/"abc"`, true},
+		{`W/"abc"`, `"abc"`, true},
+		{`W/"abc"`, `W/"abc"`, true},
+		{`"abc"`, `"abd"`, false},
+		{`W/"abc"`, `W/"abd"`, false},
+		{`"abc"`, `W/"abcd"`, false},
+		{`"abc"`, "", false},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		if got := weakETagEqual(tt.a, tt.b); got != tt.equal {
+			t.Errorf("weakETagEqual(%v, %v) = %v, expect %v", tt.a, tt.b, got, tt.equal)
+		}
+	}
+}
@@ -16,6 +16,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 )
 
 // HTTPReaderAt is io.ReaderAt implementation that makes HTTP Range Requests.
@@ -25,6 +27,17 @@ type HTTPReaderAt struct {
 	client Requester
 	req    *http.Request
 	meta   Meta
+	cfg    *config
+	// probed is false if the probe was skipped by WithKnownSize
+	probed bool
+	// probeByte is the first byte of the file kept by WithProbeCheck
+	probeByte []byte
+	// stored is the file kept by WithTinyFile or WithStore
+	stored io.ReaderAt
+	// rangeLost is set when a read got a response without range after
+	// the probe got one, shared with the clones but not with the readers
+	// of other mirrors sharing cfg
+	rangeLost *atomic.Bool
 }
 
 var _ io.ReaderAt = (*HTTPReaderAt)(nil)
@@ -33,40 +46,158 @@ var _ io.ReaderAt = (*HTTPReaderAt)(nil)
 // our feet.
 var ErrValidationFailed = errors.New("validation failed")
 
+// ErrFileChanged error is returned by a read if the server answered its
+// If-Range request with the whole current file, its validator no longer
+// matches the probe one. It wraps ErrValidationFailed.
+var ErrFileChanged = fmt.Errorf("file changed since the probe %w", ErrValidationFailed)
+
+// ErrShortBody error is returned by a read if the response body ended
+// before its Content-Length. It wraps io.ErrUnexpectedEOF, the read is
+// retried like the other transient failures.
+var ErrShortBody = fmt.Errorf("response body shorter than its Content-Length %w", io.ErrUnexpectedEOF)
+
+// ErrMissingETag error is returned if a response has no ETag
+// and WithRequireETag is set.
+var ErrMissingETag = errors.New("missing ETag in http response")
+
+// ErrUnexpectedEncoding error is returned if a range response is
+// content-encoded, its bytes don't match the offsets of the file.
+var ErrUnexpectedEncoding = errors.New("unexpected content encoding in range response")
+
+// ErrUnknownSize error is returned if an operation needs the size
+// of the file but the server did not tell it.
+var ErrUnknownSize = errors.New("unknown file size")
+
 // ErrNoRange error is returned if the server does not support range
 // requests and there is no Store defined for buffering the file.
 var ErrNoRange = errors.New("server does not support range requests")
 
+// ErrOutOfRange error is returned by ReadRange if the range asked for
+// is not entirely in the file.
+var ErrOutOfRange = errors.New("range out of file")
+
+// StatusError is returned when the server answers with another status
+// than 206 Partial Content. The body of Response is already closed.
+type StatusError struct {
+	Response *http.Response
+	// Err is ErrNoRange if the server answered 200 with the full content
+	Err error
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	var e = &StatusError{Response: resp}
+	if resp.StatusCode == http.StatusOK {
+		e.Err = ErrNoRange
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	var msg = fmt.Sprintf("unexpect http request : %s, expect %v", e.Response.Status, http.StatusPartialContent)
+	if e.Err != nil {
+		msg += " " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
 // New creates a new HTTPReaderAt. If nil is passed as http.Client, then
 // http.DefaultClient is used. The supplied http.Request is used as a
 // prototype for requests. It is copied before making the actual request.
 // It is an error to specify any other HTTP method than "GET".
 func New(client Requester, req *http.Request) (ra *HTTPReaderAt, err error) {
+	return NewWithOptions(client, req)
+}
+
+// NewWithOptions is like New but the reader is configured by opts.
+func NewWithOptions(client Requester, req *http.Request, opts ...Option) (ra *HTTPReaderAt, err error) {
+	ra, _, err = NewWithInfo(client, req, opts...)
+	return ra, err
+}
+
+// Info is the file metadata learned by the probe request of New.
+type Info struct {
+	// SupportsRange is false if the server answered the probe with 200
+	SupportsRange bool
+	// Size is -1 if the server did not tell it
+	Size         int64
+	ETag         string
+	LastModified string
+	ContentType  string
+}
+
+// NewWithInfo is like NewWithOptions but also returns the probe result.
+// If the server does not support range requests, the error wraps ErrNoRange
+// and Info is still filled from the full response, so the caller can decide
+// to download the whole file in another way without probing again.
+func NewWithInfo(client Requester, req *http.Request, opts ...Option) (*HTTPReaderAt, Info, error) {
+	var cfg = newConfig(opts)
+	if err := cfg.check(); err != nil {
+		return nil, Info{}, err
+	}
+	client = cfg.requester(client)
 	if (client == nil) || (req == nil) {
-		return nil, errors.New("invalid args")
+		return nil, Info{}, errors.New("invalid args")
 	}
 	if req.Method != http.MethodGet {
-		return nil, errors.New("invalid HTTP method, must be GET")
+		return nil, Info{}, errors.New("invalid HTTP method, must be GET")
 	}
-	ra = &HTTPReaderAt{
-		client: client,
-		req:    req,
+	warnClientTimeout(client, cfg.logger)
+	var ra = &HTTPReaderAt{
+		client:    client,
+		req:       req,
+		cfg:       cfg,
+		rangeLost: &atomic.Bool{},
 	}
-	// Make 1 byte Range Request to see if they are supported or not.
-	// Also stores the file metadata for later use.
-	if err = ra.init(); err != nil {
-		return nil, err
+	var err error
+	if ra.cfg.knownSize >= 0 {
+		ra.meta = Meta{start: -1, end: -1, size: ra.cfg.knownSize}
+	} else {
+		// Make 1 byte Range Request to see if they are supported or not.
+		// Also stores the file metadata for later use.
+		err = ra.init()
+		ra.probed = true
+	}
+	var info = Info{
+		SupportsRange: err == nil && ra.stored == nil,
+		Size:          ra.meta.size,
+		ETag:          ra.meta.etag,
+		LastModified:  ra.meta.lastModified,
+		ContentType:   ra.meta.contentType,
+	}
+	if err == nil && ra.probed && ra.cfg.requireETag && ra.meta.etag == "" {
+		err = ErrMissingETag
+	}
+	if err == nil && ra.probed && ra.cfg.validation == ValidateAll &&
+		ra.meta.etag == "" && ra.meta.lastModified == "" {
+		ra.cfg.logger.Printf("%v has neither ETag nor Last-Modified, only the size is validated, "+
+			"set WithValidation(ValidateSizeOnly) to acknowledge it", req.URL)
 	}
-	return ra, nil
+	if err != nil {
+		return nil, info, err
+	}
+	return ra, info, nil
 }
 
 // Clone return a new HTTPReaderAt with new context
 // and new HTTPReaderAt will not call init()
+// The clone is cheap: it shares the probe metadata, the configuration and
+// the stored file with ra, only its prototype request is bound to ctx.
+// Cancelling ctx stops the reads of the clone, not the ones of ra.
+// Like ra it is safe for concurrent use, closing either closes the store.
 func (ra *HTTPReaderAt) Clone(ctx context.Context) *HTTPReaderAt {
 	return &HTTPReaderAt{
-		client: ra.client,
-		req:    ra.req.WithContext(ctx),
-		meta:   ra.meta,
+		client:    ra.client,
+		req:       ra.req.WithContext(ctx),
+		meta:      ra.meta,
+		cfg:       ra.cfg,
+		probed:    ra.probed,
+		probeByte: ra.probeByte,
+		stored:    ra.stored,
+		rangeLost: ra.rangeLost,
 	}
 }
 
@@ -80,32 +211,205 @@ func (ra *HTTPReaderAt) LastModified() string {
 	return ra.meta.lastModified
 }
 
-// Size returns the size of the file.
+// Meta returns the metadata of the probe response.
+func (ra *HTTPReaderAt) Meta() Meta {
+	return ra.meta
+}
+
+// ETag returns "ETag" header contents of the probe response.
+func (ra *HTTPReaderAt) ETag() string {
+	return ra.meta.etag
+}
+
+// SupportsRange reports whether the reader fetches the file with range
+// requests: false if the server answered the probe without range, the file
+// is then stored, or if it stopped answering range requests since.
+func (ra *HTTPReaderAt) SupportsRange() bool {
+	return ra.stored == nil && !ra.rangeLost.Load()
+}
+
+// AcceptRanges returns "Accept-Ranges" header contents of the probe
+// response, many servers support range requests without sending it.
+func (ra *HTTPReaderAt) AcceptRanges() string {
+	return ra.meta.acceptRanges
+}
+
+// Size returns the size of the file, -1 if it is unknown.
+//
+// A server may not know the size when the probe is answered, with a
+// Content-Range like bytes 0-0/*. The size is then learned lazily from the
+// total of the first later response telling it, so Size may change from -1
+// once a read completed, for the reader and all its clones. Call
+// DiscoverSize to learn it up front.
 func (ra *HTTPReaderAt) Size() int64 {
-	return ra.meta.size
+	if ra.meta.size != -1 {
+		return ra.meta.size
+	}
+	if ra.cfg.sizeKnown.Load() {
+		return ra.cfg.lazySize.Load()
+	}
+	return -1
+}
+
+// learnSize records the size of a file unknown at probe time.
+func (ra *HTTPReaderAt) learnSize(size int64) {
+	if ra.meta.size == -1 && size != -1 {
+		ra.cfg.lazySize.Store(size)
+		ra.cfg.sizeKnown.Store(true)
+	}
+}
+
+// DiscoverSize returns the size of the file, if it is still unknown it
+// asks for the last byte with a suffix range request to learn it.
+// It fails with ErrUnknownSize if the server does not tell the size either.
+func (ra *HTTPReaderAt) DiscoverSize(ctx context.Context) (int64, error) {
+	if size := ra.Size(); size != -1 {
+		return size, nil
+	}
+	if _, err := ra.Clone(ctx).ReadSuffix(make([]byte, 1)); err != nil {
+		return -1, fmt.Errorf("%w: %v", ErrUnknownSize, err)
+	}
+	return ra.Size(), nil
+}
+
+// ReadAll reads the whole file through ReadAt with ctx, one request of the
+// configured chunk size after another, so callers don't have to allocate
+// and loop themselves.
+func (ra *HTTPReaderAt) ReadAll(ctx context.Context) ([]byte, error) {
+	var size = ra.Size()
+	if size < 0 {
+		return nil, ErrUnknownSize
+	}
+	var reader = ra.Clone(ctx)
+	var buf = make([]byte, size)
+	for off := int64(0); off < size; off += ra.cfg.chunkSize {
+		var end = off + ra.cfg.chunkSize
+		if end > size {
+			end = size
+		}
+		var n, err = reader.ReadAt(buf[off:end], off)
+		if err != nil && !(err == io.EOF && int64(n) == end-off) {
+			return nil, err
+		}
+	}
+	return buf, nil
 }
 
 func (ra *HTTPReaderAt) init() error {
-	var req = ra.cloneRequest()
+	if ra.cfg.headProbe {
+		if done, err := ra.probeHead(); done || err != nil {
+			return err
+		}
+	}
+	var req, err = ra.newRequest()
+	if err != nil {
+		return err
+	}
 	// Warning: not reset the http method to head, req.Method = http.MethodHead
 	// if reset, the signature maybe invalid
-	req.Header.Set("Range", "bytes=0-0")
-	var resp, err = ra.client.Do(req)
-	if err != nil {
+	var probeSize = ra.cfg.probeSize
+	if probeSize < 1 {
+		probeSize = 1
+	}
+	req.Header.Set(HttpHeaderRange, fmt.Sprintf(HttpHeaderRangeFormat, 0, probeSize-1))
+	var ctx, cancel = ra.cfg.withDeadline(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	var resp *http.Response
+	if resp, err = ra.client.Do(req); err != nil {
 		return fmt.Errorf("http request error %w", err)
 	}
 	defer resp.Body.Close()
+	var read int64
+	defer func() { ra.cfg.stats.record(req, resp, read) }()
 
+	if isEmptyFile(resp) {
+		// there is no byte to range over, every read is at the end of file
+		ra.meta, _ = getMeta(resp)
+		ra.meta.size = 0
+		return nil
+	}
+	if resp.StatusCode == http.StatusOK {
+		// keep the metadata of the full response for NewWithInfo
+		ra.meta, _ = getMeta(resp)
+		return ra.keepWhole(resp, &read)
+	}
 	if resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("unexpect http request : %s, expect %v", resp.Status, http.StatusPartialContent)
+		return newStatusError(resp)
+	}
+	if err = checkEncoding(resp); err != nil {
+		return err
 	}
 	if ra.meta, err = getMeta(resp); err != nil {
 		return err
 	}
+	var head []byte
+	if head, err = io.ReadAll(io.LimitReader(resp.Body, probeSize)); err != nil {
+		return err
+	}
+	read = int64(len(head))
+	if ra.cfg.probeCheck && len(head) > 0 {
+		ra.probeByte = head[:1]
+	}
+	if ra.cfg.probeSize > 0 && ra.meta.start == 0 && int64(len(head)) == ra.meta.end+1 {
+		ra.cfg.head.keep(head)
+	}
 	io.Copy(io.Discard, resp.Body)
 	return nil
 }
 
+// isEmptyFile reports whether the probe response is about a file of zero
+// bytes: a 200 without body, or a 416 with "Content-Range: bytes */0".
+func isEmptyFile(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength == 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		var first, _, length, err = parseContentRange(resp.Header.Get(HttpHeaderContentRange))
+		return err == nil && first == -1 && length == 0
+	}
+	return false
+}
+
+// probeHead learns the metadata with a HEAD request for WithHeadProbe,
+// it reports false if the response is not enough and init must go on
+// with the range probe.
+func (ra *HTTPReaderAt) probeHead() (bool, error) {
+	var req, err = ra.newRequest()
+	if err != nil {
+		return false, err
+	}
+	req.Method = http.MethodHead
+	var ctx, cancel = ra.cfg.withDeadline(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	var resp *http.Response
+	if resp, err = ra.client.Do(req); err != nil {
+		return false, fmt.Errorf("http request error %w", err)
+	}
+	resp.Body.Close()
+	ra.cfg.stats.record(req, resp, 0)
+
+	// 405 or 501 for a server without HEAD, or no size: use the range probe
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return false, nil
+	}
+	var acceptRanges = resp.Header.Get("Accept-Ranges")
+	if acceptRanges == "none" {
+		ra.meta, _ = getMeta(resp)
+		return true, newStatusError(resp)
+	}
+	// many servers support range requests without telling it,
+	// only the range probe can tell then
+	if !strings.EqualFold(acceptRanges, "bytes") {
+		return false, nil
+	}
+	if ra.meta, err = getMeta(resp); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // ReadAt reads len(b) bytes from the remote file starting at byte offset
 // off. It returns the number of bytes read and the error, if any. ReadAt
 // always returns a non-nil error when n < len(b). At end of file, that
@@ -114,20 +418,83 @@ func (ra *HTTPReaderAt) init() error {
 // It tries to notice if the file changes by tracking the size as well as
 // Content-Type, Last-Modified and ETag headers between consecutive ReadAt
 // calls. In case any change is detected, ErrValidationFailed is returned.
+// Each request also carries If-Range with the probe validator, a file
+// changed before the server answers it fails with ErrFileChanged.
 func (ra *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	var req = ra.cloneRequest()
+	var req, err = ra.newRequest()
+	if err != nil {
+		return 0, err
+	}
+	return ra.readAt(req, p, off)
+}
+
+// ReadRange reads exactly the bytes [off, off+len(p)) into p. Unlike
+// ReadAt it does not clamp a range going past the end of the file, it fails
+// with ErrOutOfRange without any request instead, and it never returns io.EOF.
+// If the size of the file is unknown a short read fails with ErrOutOfRange.
+func (ra *HTTPReaderAt) ReadRange(p []byte, off int64) (int, error) {
+	var end = off + int64(len(p))
+	var size = ra.Size()
+	if off < 0 || (size != -1 && end > size) {
+		return 0, fmt.Errorf("%w: %v-%v of size %v", ErrOutOfRange, off, end, size)
+	}
+	var n, err = ra.ReadAt(p, off)
+	if err == io.EOF {
+		if n == len(p) {
+			return n, nil
+		}
+		err = fmt.Errorf("%w: %v-%v but read %v bytes", ErrOutOfRange, off, end, n)
+	}
+	return n, err
+}
+
+// readAt is ReadAt with a request made by newRequest,
+// the request can be sent again once readAt returned.
+func (ra *HTTPReaderAt) readAt(req *http.Request, p []byte, off int64) (int, error) {
+	if ra.stored != nil {
+		var n, err = ra.readStored(p, off)
+		ra.cfg.noteCache(off, n, true)
+		return n, err
+	}
+	if ra.cfg.head.take(p, off) {
+		ra.cfg.noteCache(off, len(p), true)
+		return len(p), nil
+	}
+	if _, inChunk := ChunkInfoFromContext(req.Context()); ra.cfg.readahead != nil && !inChunk {
+		if n, ok, err := ra.readWindow(req, p, off); ok {
+			return n, err
+		}
+	}
+	if ra.cfg.blocks != nil {
+		return ra.readBlocks(req, p, off)
+	}
+	var n, err = ra.fetchAt(req, p, off)
+	ra.cfg.noteCache(off, n, false)
+	return n, err
+}
+
+// fetchAt is readAt from the network.
+func (ra *HTTPReaderAt) fetchAt(req *http.Request, p []byte, off int64) (int, error) {
+	defer ra.cfg.lockRead()()
+	var cancel context.CancelFunc
+	if ra.cfg.stallTimeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(req.Context())
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
 
 	var reqFirst = off
 	var reqLast = off + int64(len(p)) - 1
 
 	var returnErr error
-	if ra.meta.size != -1 && reqLast > ra.meta.size-1 {
+	if size := ra.Size(); size != -1 && reqLast > size-1 {
 		// Clamp down the requested range because some servers return
 		// "416 Range Not Satisfiable" if trying to read past the end of the file.
-		reqLast = ra.meta.size - 1
+		reqLast = size - 1
 		returnErr = io.EOF
 		if reqLast < reqFirst {
 			return 0, io.EOF
@@ -137,15 +504,33 @@ func (ra *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
 
 	var reqRange = fmt.Sprintf(HttpHeaderRangeFormat, reqFirst, reqLast)
 	req.Header.Set("Range", reqRange)
+	ra.setIfRange(req)
 
 	var resp, err = ra.client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("http request error %w", err)
 	}
 	defer resp.Body.Close()
+	var n int
+	defer func() { ra.cfg.stats.record(req, resp, int64(n)) }()
 
+	if resp.StatusCode == http.StatusOK && req.Header.Get("If-Range") != "" {
+		// a server ignoring Range also ignores If-Range,
+		// the file only changed if the validator did
+		if meta, _ := getMeta(resp); ra.validate(meta) != nil {
+			return 0, ErrFileChanged
+		}
+	}
 	if resp.StatusCode != http.StatusPartialContent {
-		return 0, fmt.Errorf("unexpect http request : %s, expect %v %w", resp.Status, http.StatusPartialContent, ErrNoRange)
+		var statusErr = newStatusError(resp)
+		if errors.Is(statusErr, ErrNoRange) {
+			// it passed the probe, the next reads must not try again
+			ra.rangeLost.Store(true)
+		}
+		return 0, statusErr
+	}
+	if err = checkEncoding(resp); err != nil {
+		return 0, err
 	}
 
 	var meta Meta
@@ -153,43 +538,339 @@ func (ra *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
 		return 0, err
 	}
 	// check
-	if ra.meta.size != meta.size ||
-		ra.meta.lastModified != meta.lastModified ||
-		ra.meta.etag != meta.etag {
-		return 0, ErrValidationFailed
+	if err = ra.validate(meta); err != nil {
+		return 0, err
 	}
-	if meta.start != reqFirst || meta.end > reqLast {
+	if meta.start != reqFirst {
 		return 0, fmt.Errorf(
-			"received different range than requested (req=%d-%d, resp=%d-%d)",
+			"received range starts at a different offset than requested (req=%d-%d, resp=%d-%d), "+
+				"the server or a proxy shifted the range",
+			reqFirst, reqLast, meta.start, meta.end)
+	}
+	if meta.end > reqLast && !ra.cfg.lenientRange {
+		return 0, fmt.Errorf(
+			"received range ends after the requested one (req=%d-%d, resp=%d-%d), "+
+				"the server or a proxy padded the range",
 			reqFirst, reqLast, meta.start, meta.end)
 	}
 	if resp.ContentLength != meta.end-meta.start+1 {
 		return 0, errors.New("content-length mismatch in http response")
 	}
-	var n int
-	n, err = io.ReadFull(resp.Body, p)
+	var body io.Reader = resp.Body
+	if cancel != nil {
+		var stall = newStallReader(resp.Body, ra.cfg.stallTimeout, cancel)
+		defer stall.stop()
+		body = stall
+	}
+	body = ra.cfg.limitReader(req.Context(), body)
+	n, err = io.ReadFull(body, p)
+	if errors.Is(err, ErrStalled) {
+		ra.cfg.stalls.Add(1)
+		return n, err
+	}
 
+	if (err == nil || err == io.ErrUnexpectedEOF || err == io.EOF) &&
+		n < len(p) && int64(n) < resp.ContentLength {
+		// the connection ended before the advertised body, a truncated transfer
+		return n, fmt.Errorf("read %v of %v bytes %w", n, resp.ContentLength, ErrShortBody)
+	}
 	if err == io.ErrUnexpectedEOF {
+		// the server sent a shorter range than requested
 		err = io.EOF
 	}
-	if (err == nil || err == io.EOF) && int64(n) != resp.ContentLength {
-		// XXX body size was different from the ContentLength
-		// header? should we do something about it? return error?
-		fmt.Printf("bodySize %v != header ContentLength %v", n, resp.ContentLength)
-	}
 	if err == nil && returnErr != nil {
 		err = returnErr
 	}
+	if reqFirst == 0 && n > 0 && len(ra.probeByte) == 1 && p[0] != ra.probeByte[0] {
+		return 0, fmt.Errorf("first byte differs from the probe one %w", ErrValidationFailed)
+	}
+
+	if ra.cfg.verbose {
+		ra.cfg.logger.Printf("read contentRange %v length %v", resp.Header.Get(HttpHeaderContentRange), n)
+	}
+	return n, err
+}
+
+// finalValidate checks the file did not change during a download
+// when WithFinalValidation is set.
+func (ra *HTTPReaderAt) finalValidate(ctx context.Context) error {
+	// a tiny file came in a single response, it can't have changed during it
+	if !ra.cfg.finalValidation || ra.stored != nil {
+		return nil
+	}
+	var req, err = ra.newRequest()
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(HttpHeaderRange, "bytes=0-0")
+	// If-Match uses the strong comparison, a weak ETag never matches it
+	// and is only compared with the one of the response by validate
+	switch {
+	case ra.meta.etag != "" && !strings.HasPrefix(ra.meta.etag, "W/"):
+		req.Header.Set("If-Match", ra.meta.etag)
+	case ra.meta.lastModified != "":
+		req.Header.Set("If-Unmodified-Since", ra.meta.lastModified)
+	case ra.meta.etag == "":
+		return fmt.Errorf("no validator to check the file did not change %w", ErrValidationFailed)
+	}
+	var resp *http.Response
+	if resp, err = ra.client.Do(req); err != nil {
+		return fmt.Errorf("http request error %w", err)
+	}
+	defer resp.Body.Close()
+	defer func() { ra.cfg.stats.record(req, resp, 0) }()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return ErrValidationFailed
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return newStatusError(resp)
+	}
+	var meta Meta
+	if meta, err = getMeta(resp); err != nil {
+		return err
+	}
+	return ra.validate(meta)
+}
+
+// ReadSuffix reads the last len(p) bytes of the file with a suffix range
+// request bytes=-N, so it works even if the size is unknown, like to find
+// the end of central directory of a zip archive. The size is then learned
+// from the total of the Content-Range of the response, see Size.
+// If the file is shorter than p, n is the file size.
+func (ra *HTTPReaderAt) ReadSuffix(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if ra.stored != nil {
+		var off = ra.meta.size - int64(len(p))
+		if off < 0 {
+			off = 0
+		}
+		var n, err = ra.readStored(p[:ra.meta.size-off], off)
+		ra.cfg.noteCache(off, n, true)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	}
+	var req, err = ra.newRequest()
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(HttpHeaderRange, fmt.Sprintf(HttpHeaderSuffixRangeFormat, len(p)))
+	defer ra.cfg.lockRead()()
+
+	var resp *http.Response
+	if resp, err = ra.client.Do(req); err != nil {
+		return 0, fmt.Errorf("http request error %w", err)
+	}
+	defer resp.Body.Close()
+
+	var n int
+	defer func() { ra.cfg.stats.record(req, resp, int64(n)) }()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, newStatusError(resp)
+	}
+	if err = checkEncoding(resp); err != nil {
+		return 0, err
+	}
+	var meta Meta
+	if meta, err = getMeta(resp); err != nil {
+		return 0, err
+	}
+	if meta.size == -1 || meta.end != meta.size-1 {
+		return 0, fmt.Errorf("received invalid suffix range (req=-%d, resp=%d-%d/%d)",
+			len(p), meta.start, meta.end, meta.size)
+	}
+	if err = ra.validate(meta); err != nil {
+		return 0, err
+	}
+	var length = meta.end - meta.start + 1
+	if length > int64(len(p)) {
+		return 0, fmt.Errorf("received larger suffix range than requested (req=-%d, resp=%d-%d)",
+			len(p), meta.start, meta.end)
+	}
+	n, err = io.ReadFull(resp.Body, p[:length])
+	ra.cfg.noteCache(meta.start, n, false)
+	return n, err
+}
+
+// CopyRange copies the bytes [off, off+n) of the file to w with a single
+// range request, streaming the body without a buffer of n bytes, for
+// example to extract a zip member to disk. The response is checked like
+// in ReadAt. Like ReadRange it fails with ErrOutOfRange if the range is
+// not entirely in the file, and it returns the number of bytes copied.
+func (ra *HTTPReaderAt) CopyRange(ctx context.Context, w io.Writer, off, n int64) (int64, error) {
+	var size = ra.Size()
+	if off < 0 || n < 0 || (size != -1 && off+n > size) {
+		return 0, fmt.Errorf("%w: %v-%v of size %v", ErrOutOfRange, off, off+n, size)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var req, err = ra.newRequest()
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(HttpHeaderRange, fmt.Sprintf(HttpHeaderRangeFormat, off, off+n-1))
+	defer ra.cfg.lockRead()()
+
+	var resp *http.Response
+	if resp, err = ra.client.Do(req); err != nil {
+		return 0, fmt.Errorf("http request error %w", err)
+	}
+	defer resp.Body.Close()
+
+	var written int64
+	defer func() { ra.cfg.stats.record(req, resp, written) }()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, newStatusError(resp)
+	}
+	if err = checkEncoding(resp); err != nil {
+		return 0, err
+	}
+	var meta Meta
+	if meta, err = getMeta(resp); err != nil {
+		return 0, err
+	}
+	if err = ra.validate(meta); err != nil {
+		return 0, err
+	}
+	if meta.start != off || meta.end != off+n-1 {
+		return 0, fmt.Errorf("received range differs from the requested one (req=%d-%d, resp=%d-%d)",
+			off, off+n-1, meta.start, meta.end)
+	}
+	written, err = io.CopyN(w, ra.cfg.limitReader(req.Context(), resp.Body), n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return written, err
+}
+
+// copyFrom copies the file from off to its end into w with a single
+// open range request, for a file of unknown size.
+// A server ignoring the range is accepted if off is 0.
+func (ra *HTTPReaderAt) copyFrom(w io.Writer, off int64) (int64, error) {
+	var req, err = ra.newRequest()
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(HttpHeaderRange, fmt.Sprintf(HttpHeaderOpenRangeFormat, off))
+	defer ra.cfg.lockRead()()
+
+	var resp *http.Response
+	if resp, err = ra.client.Do(req); err != nil {
+		return 0, fmt.Errorf("http request error %w", err)
+	}
+	defer resp.Body.Close()
 
-	// you can debug print how many bytes download
-	// fmt.Printf("read contentRange %v length %v\n", contentRange, n)
+	var n int64
+	defer func() { ra.cfg.stats.record(req, resp, n) }()
+
+	switch {
+	case resp.StatusCode == http.StatusOK && off == 0:
+	case resp.StatusCode == http.StatusPartialContent:
+		if err = checkEncoding(resp); err != nil {
+			return 0, err
+		}
+		var meta Meta
+		if meta, err = getMeta(resp); err != nil {
+			return 0, err
+		}
+		if err = ra.validate(meta); err != nil {
+			return 0, err
+		}
+		if meta.start != off {
+			return 0, fmt.Errorf("received range starts at a different offset than requested (req=%d-, resp=%d-%d)",
+				off, meta.start, meta.end)
+		}
+	default:
+		return 0, newStatusError(resp)
+	}
+	n, err = io.Copy(w, ra.cfg.limitReader(req.Context(), resp.Body))
 	return n, err
 }
 
+// setIfRange makes the server answer the range request only if the file
+// still matches the probe validator, the whole file comes otherwise.
+// A weak ETag can't be used for it, Last-Modified is then the validator.
+func (ra *HTTPReaderAt) setIfRange(req *http.Request) {
+	if !ra.probed || ra.cfg.validation == ValidateSizeOnly {
+		return
+	}
+	switch {
+	case ra.meta.etag != "" && !strings.HasPrefix(ra.meta.etag, "W/"):
+		req.Header.Set("If-Range", ra.meta.etag)
+	case ra.meta.lastModified != "":
+		req.Header.Set("If-Range", ra.meta.lastModified)
+	}
+}
+
+// validate checks the metadata of a response against the probe one.
+func (ra *HTTPReaderAt) validate(meta Meta) error {
+	if ra.cfg.requireETag && meta.etag == "" {
+		return ErrMissingETag
+	}
+	if size := ra.Size(); size == -1 {
+		ra.learnSize(meta.size)
+	} else if size != meta.size {
+		return ErrValidationFailed
+	}
+	// without the probe there is no validator to compare
+	if !ra.probed || ra.cfg.validation == ValidateSizeOnly {
+		return nil
+	}
+	if ra.meta.lastModified != meta.lastModified ||
+		!weakETagEqual(ra.meta.etag, meta.etag) {
+		return ErrValidationFailed
+	}
+	return nil
+}
+
+// newRequest returns a copy of the prototype request prepared by the
+// WithURLProvider and WithRequestMutator hooks.
+func (ra *HTTPReaderAt) newRequest() (*http.Request, error) {
+	var req = ra.cloneRequest()
+	if err := ra.cfg.prepare(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// checkEncoding fails if a proxy compressed the response even though
+// range requests are about the raw bytes of the file.
+func checkEncoding(resp *http.Response) error {
+	var encoding = resp.Header.Get("Content-Encoding")
+	if resp.Uncompressed {
+		// the transport removed the header when it decompressed the body
+		encoding = "gzip"
+	}
+	if encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return fmt.Errorf("%w: %s", ErrUnexpectedEncoding, encoding)
+	}
+	return nil
+}
+
 func (ra *HTTPReaderAt) cloneRequest() *http.Request {
 	out := *ra.req
 	out.Body = nil
 	out.ContentLength = 0
+	out.Close = ra.cfg.closeConn
 	out.Header = cloneHeader(ra.req.Header)
+	// the URL is a pointer, copy it so a clone can be mutated
+	// without touching the prototype and the other clones
+	if ra.req.URL != nil {
+		var u = *ra.req.URL
+		if u.User != nil {
+			var user = *u.User
+			u.User = &user
+		}
+		out.URL = &u
+	}
 	return &out
 }
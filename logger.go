@@ -0,0 +1,62 @@
+package httprange
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger receives the warnings of the package, *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// WithLogger sets the Logger of the warnings, they are discarded by default.
+func WithLogger(l Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithVerbose makes the reader also log a trace line for every range
+// read, with the Content-Range of the response and the bytes read.
+func WithVerbose() Option {
+	return func(c *config) {
+		c.verbose = true
+	}
+}
+
+// WithLogFields attaches fields to the download, like a correlation ID,
+// every line logged for it starts with them as key=value pairs, so the
+// lines of concurrent downloads sharing a Logger can be told apart.
+// kv alternates keys and values, a missing last value is logged empty.
+func WithLogFields(kv ...any) Option {
+	return func(c *config) {
+		c.logFields = append(c.logFields, kv...)
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...any) {}
+
+// fieldsLogger prefixes the lines of a Logger with fields.
+type fieldsLogger struct {
+	l      Logger
+	prefix string
+}
+
+func newFieldsLogger(l Logger, kv []any) Logger {
+	var b strings.Builder
+	for i := 0; i < len(kv); i += 2 {
+		var v any = ""
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		fmt.Fprintf(&b, "%v=%v ", kv[i], v)
+	}
+	return &fieldsLogger{l: l, prefix: b.String()}
+}
+
+func (f *fieldsLogger) Printf(format string, v ...any) {
+	f.l.Printf("%s"+format, append([]any{f.prefix}, v...)...)
+}
@@ -0,0 +1,131 @@
+package httprange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrMirrorMismatch error is returned by DoMirrors if two mirrors report
+// a different size or ETag, their files can't be mixed.
+var ErrMirrorMismatch = errors.New("mirrors disagree on the file")
+
+// DoMirrors downloads the same file from several mirror URLs at once.
+// Every mirror is probed, the ones failing it or not supporting range
+// requests are skipped, and the others must agree on the size and on the
+// ETag when both have one. The workers spread the chunks on the mirrors, a
+// chunk failing on one after its retries is read again from the next one.
+// The options apply to all the mirrors and their limits, like
+// WithConcurrency or WithRateLimit, are shared.
+func DoMirrors(ctx context.Context, clt Requester, urls []string, opts ...Option) ([]byte, error) {
+	var readers, chunkSize, err = probeMirrors(ctx, clt, urls, opts)
+	if err != nil {
+		return nil, err
+	}
+	var primary = readers[0]
+	var cfg = primary.cfg
+	defer cfg.flushStats()
+	defer func() {
+		for _, ra := range readers {
+			ra.Close()
+		}
+	}()
+
+	var buf = make([]byte, primary.Size())
+	var taskList = makeMemoryTask(0, primary.Size(), chunkSize, buf)
+	var taskCh = make(chan memoryTaskType, len(taskList))
+	for _, task := range taskList {
+		taskCh <- task
+	}
+	close(taskCh)
+
+	var group, errCtx = errgroup.WithContext(ctx)
+	for i := 0; i < cfg.concurrency; i++ {
+		var first = i % len(readers)
+		group.Go(func() error {
+			for task := range taskCh {
+				if err := readMirrors(errCtx, readers, first, task); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err = group.Wait(); err != nil {
+		return nil, err
+	}
+	if err = primary.finalValidate(ctx); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// probeMirrors creates the readers of the usable mirrors, they share the
+// configuration of the first one.
+func probeMirrors(ctx context.Context, clt Requester, urls []string, opts []Option) ([]*HTTPReaderAt, int64, error) {
+	var readers []*HTTPReaderAt
+	var closeAll = func() {
+		for _, ra := range readers {
+			ra.Close()
+		}
+	}
+	var lastErr = errors.New("no mirror url")
+	for _, url := range urls {
+		var req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			closeAll()
+			return nil, 0, err
+		}
+		var ra *HTTPReaderAt
+		var info Info
+		if ra, info, err = NewWithInfo(clt, req, opts...); err != nil {
+			lastErr = fmt.Errorf("mirror %v %w", url, err)
+			continue
+		}
+		if !info.SupportsRange || info.Size < 0 {
+			ra.Close()
+			lastErr = fmt.Errorf("mirror %v %w", url, ErrNoRange)
+			continue
+		}
+		if len(readers) > 0 {
+			var primary = readers[0]
+			if ra.Size() != primary.Size() ||
+				(ra.ETag() != "" && primary.ETag() != "" && !weakETagEqual(ra.ETag(), primary.ETag())) {
+				ra.Close()
+				closeAll()
+				return nil, 0, fmt.Errorf("mirror %v size %v etag %v, mirror %v size %v etag %v %w",
+					primary.req.URL, primary.Size(), primary.ETag(), url, ra.Size(), ra.ETag(), ErrMirrorMismatch)
+			}
+			ra.cfg = primary.cfg
+		}
+		readers = append(readers, ra)
+	}
+	if len(readers) == 0 {
+		return nil, 0, lastErr
+	}
+	var cfg = readers[0].cfg
+	var chunkSize, err = cfg.planChunkSize(readers[0].Size())
+	if err != nil {
+		closeAll()
+		return nil, 0, err
+	}
+	cfg.stats.planChunks(0, readers[0].Size(), chunkSize)
+	return readers, chunkSize, nil
+}
+
+// readMirrors reads task from the mirrors in turn from the first one,
+// until one succeeds.
+func readMirrors(ctx context.Context, readers []*HTTPReaderAt, first int, task memoryTaskType) error {
+	var err error
+	for k := range readers {
+		var ra = readers[(first+k)%len(readers)]
+		if err = readChunk(ctx, ra, task); err == nil || ctx.Err() != nil {
+			return err
+		}
+		ra.cfg.logger.Printf("mirror %v failed, trying the next one: %v", ra.req.URL, err)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoMirrorsRangeLost(t *testing.T) {
+	var data = bytes.Repeat([]byte("mirror"), 5000)
+	var requestsA atomic.Int32
+	// a passes the probe then ignores Range
+	var a = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestsA.Add(1) > 1 {
+			r.Header.Del(HttpHeaderRange)
+		}
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer a.Close()
+	var b = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer b.Close()
+
+	var got, err = DoMirrors(context.Background(), a.Client(), []string{a.URL, b.URL},
+		WithChunkSize(1000), WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("content differs")
+	}
+	// the probe and the first chunk, then a is skipped without request
+	if n := requestsA.Load(); n != 2 {
+		t.Fatalf("mirror a got %v requests, expect 2", n)
+	}
+}
@@ -0,0 +1,562 @@
+package httprange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTooManyRequests is returned when a download plan needs more range
+// requests than allowed by WithMaxRequests.
+var ErrTooManyRequests = errors.New("download plan exceeds max requests")
+
+const (
+	defaultConcurrency        = 48
+	defaultChunkSize    int64 = 64 * 1024
+	defaultChunkTimeout       = time.Minute
+)
+
+// Option configures the downloader and the HTTPReaderAt.
+type Option func(*config)
+
+type config struct {
+	concurrency int
+	chunkSize   int64
+	// maxRequests caps the number of range requests of a download, 0 means no limit
+	maxRequests int
+	// growChunk lets the planner enlarge chunkSize to fit in maxRequests
+	growChunk bool
+	// closeConn sends every request on a fresh connection
+	closeConn bool
+
+	maxRetries     int
+	retryPredicate RetryPredicate
+	// maxRetryAfter caps the Retry-After waits, 0 for no cap
+	maxRetryAfter time.Duration
+	// retryableStatuses is nil for defaultRetryableStatuses
+	retryableStatuses []int
+	backoff           Backoff
+
+	// flushEvery is the number of bytes written between two Flush of the sink
+	flushEvery int64
+
+	stats *statsCollector
+
+	minWorkers int
+	maxWorkers int
+	throttle   *throttle
+
+	// knownSize skips the probe request when it is not -1
+	knownSize int64
+	// lazySize is the size learned after a probe which did not tell it
+	lazySize  atomic.Int64
+	sizeKnown atomic.Bool
+
+	requireETag bool
+	// lenientRange is set by WithLenientRange
+	lenientRange bool
+
+	mutator     func(*http.Request)
+	headerFuncs []headerFunc
+	allowReplay bool
+
+	finalValidation bool
+
+	sequential bool
+	// fallbackAfter is the number of failed chunk requests which make the
+	// download fall back to sequential, 0 never falls back
+	fallbackAfter int
+	failures      int32
+	fellBack      int32
+
+	transport *http.Transport
+
+	probeCheck bool
+
+	skipVerified bool
+
+	urlProvider func(ctx context.Context) (string, error)
+
+	stallTimeout time.Duration
+	stalls       atomic.Int64
+	// limiter is set by WithRateLimit
+	limiter *rateLimiter
+	// blocks is set by WithBlockCache
+	blocks *blockCache
+	// readahead is set by WithReadahead
+	readahead *readahead
+
+	logger     Logger
+	logFields  []any
+	verbose    bool
+	validation ValidationMode
+
+	timeout time.Duration
+	// deadline bounds the whole download when WithTimeout is set
+	deadline time.Time
+
+	outputPath string
+
+	serialReads bool
+	readMu      sync.Mutex
+
+	probeSize int64
+	head      headCache
+
+	headProbe bool
+
+	cleanupOnCancel bool
+
+	// tinyLimit is the largest 200 probe response kept by WithTinyFile
+	tinyLimit int64
+	store     Store
+	// noRange is set when the file is read from a response without range
+	noRange atomic.Bool
+
+	cache         cacheCounters
+	cacheObserver CacheObserver
+
+	chunkTimeout time.Duration
+
+	progress   func(downloaded, total int64)
+	downloaded atomic.Int64
+
+	// userAgent is nil for DefaultUserAgent
+	userAgent      *string
+	defaultHeaders http.Header
+}
+
+func newConfig(opts []Option) *config {
+	var c = &config{
+		concurrency:  defaultConcurrency,
+		chunkSize:    defaultChunkSize,
+		maxRetries:   defaultMaxRetries,
+		chunkTimeout: defaultChunkTimeout,
+		backoff:      ExponentialBackoff{Base: defaultRetryDelay, Max: defaultMaxRetryDelay},
+		knownSize:    -1,
+		allowReplay:  true,
+		logger:       nopLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.logFields) > 0 {
+		c.logger = newFieldsLogger(c.logger, c.logFields)
+	}
+	if c.timeout > 0 {
+		c.deadline = time.Now().Add(c.timeout)
+	}
+	switch {
+	case c.sequential, c.serialReads:
+		c.concurrency = 1
+	case c.maxWorkers > 0:
+		c.throttle = newThrottle(c.minWorkers, c.maxWorkers)
+		c.concurrency = c.throttle.max
+	case c.fallbackAfter > 0:
+		// a fixed limit, only there to be pinned to 1 by the fallback
+		c.throttle = newThrottle(c.concurrency, c.concurrency)
+	}
+	if c.throttle != nil {
+		c.throttle.maxPause = c.maxRetryAfter
+	}
+	return c
+}
+
+// WithConcurrency sets the number of concurrent chunk requests of the
+// downloads, 48 by default. Fewer workers suit small servers that rate
+// limit or drop connections, more suit high bandwidth CDNs. A value <= 0
+// makes the downloads fail before the probe.
+func WithConcurrency(n int) Option {
+	return func(c *config) {
+		c.concurrency = n
+	}
+}
+
+// WithChunkSize sets the size of the chunks of the downloads, 64KiB by
+// default. Each chunk is a range request, larger chunks mean fewer
+// requests, which is much faster against high latency origins: a 1GiB file
+// is 16384 requests of 64KiB but 128 of 8MiB. A value <= 0 makes the
+// downloads fail before the probe.
+func WithChunkSize(n int64) Option {
+	return func(c *config) {
+		c.chunkSize = n
+	}
+}
+
+// WithChunkTimeout bounds the time of every chunk request of the downloads,
+// a minute by default, a timed out chunk is retried like after any
+// transient error. Zero disables it and only the parent context bounds
+// the chunks. Raise it for large chunks on slow links.
+func WithChunkTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.chunkTimeout = d
+	}
+}
+
+// WithProgress sets a callback called every time a chunk of a download
+// completes, with the number of bytes downloaded so far and the size of the
+// file, -1 if unknown. The workers run in parallel, so it may be called
+// from several goroutines at once and must be safe for concurrent use,
+// and the calls may arrive out of order: keep the largest downloaded value.
+func WithProgress(fn func(downloaded, total int64)) Option {
+	return func(c *config) {
+		c.progress = fn
+	}
+}
+
+// check reports the invalid values set by the options.
+func (c *config) check() error {
+	if c.concurrency <= 0 {
+		return fmt.Errorf("invalid concurrency %v, must be > 0", c.concurrency)
+	}
+	if c.chunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %v, must be > 0", c.chunkSize)
+	}
+	return nil
+}
+
+// WithMaxRequests caps the number of range requests a download may make.
+// The download fails with ErrTooManyRequests before any chunk is fetched
+// if the plan would exceed n, unless WithAdaptiveChunkSize is also set.
+func WithMaxRequests(n int) Option {
+	return func(c *config) {
+		c.maxRequests = n
+	}
+}
+
+// WithAdaptiveChunkSize lets the planner increase the chunk size so that
+// the download fits in the budget given by WithMaxRequests instead of failing.
+func WithAdaptiveChunkSize() Option {
+	return func(c *config) {
+		c.growChunk = true
+	}
+}
+
+// WithConnectionClose makes every request use a fresh connection that is
+// closed after the response (req.Close = true) instead of keep-alive.
+// It works around load balancers that pin a keep-alive connection to a
+// stale backend, at the price of a new TCP (and TLS) handshake per chunk,
+// which lowers the throughput noticeably with small chunks.
+func WithConnectionClose() Option {
+	return func(c *config) {
+		c.closeConn = true
+	}
+}
+
+// WithFlushEvery makes DoToWriterAt call Flush after every n bytes written
+// when the sink implements Flusher, and once more when the download completes,
+// so sinks buffering between WriteAt calls stay bounded.
+// By default the sink is never flushed explicitly.
+func WithFlushEvery(n int64) Option {
+	return func(c *config) {
+		c.flushEvery = n
+	}
+}
+
+// WithKnownSize gives the size of the file when the caller already knows it,
+// so the reader skips the probe request and the download plans its chunks
+// directly. Without the probe the ETag and Last-Modified validators are
+// unknown, so ReadAt only checks the size of the responses against n,
+// a wrong size still fails with ErrValidationFailed on the first chunk.
+func WithKnownSize(n int64) Option {
+	return func(c *config) {
+		c.knownSize = n
+	}
+}
+
+// ValidationMode tells how ReadAt checks the file did not change.
+type ValidationMode int
+
+const (
+	// ValidateAll compares the size, the ETag and Last-Modified
+	// of every response with the probe ones.
+	ValidateAll ValidationMode = iota
+	// ValidateSizeOnly only compares the size, for servers which give
+	// no validator. It is what ValidateAll ends up doing for them, but
+	// setting it acknowledges the weak validation and silences the warning.
+	ValidateSizeOnly
+)
+
+// WithValidation sets the ValidationMode, ValidateAll by default.
+// With ValidateAll, New logs a warning if the probe response has neither
+// ETag nor Last-Modified, since a change keeping the size goes unnoticed.
+func WithValidation(mode ValidationMode) Option {
+	return func(c *config) {
+		c.validation = mode
+	}
+}
+
+// WithRequireETag makes New fail with ErrMissingETag if the probe response
+// has no ETag, and ReadAt fail the same way on any response without one,
+// instead of falling back to the weaker size and Last-Modified validation.
+func WithRequireETag() Option {
+	return func(c *config) {
+		c.requireETag = true
+	}
+}
+
+// WithLenientRange accepts a range response ending after the requested
+// range, as some S3 compatible stores and proxies send, the extra bytes are
+// dropped. A response starting at another offset still fails.
+func WithLenientRange() Option {
+	return func(c *config) {
+		c.lenientRange = true
+	}
+}
+
+// WithRequestMutator sets a hook called on every request copied from the
+// prototype just before it is sent, for example to sign it or to set a
+// freshly minted Authorization header on long downloads.
+// The hook runs again for every attempt of a chunk, so a retry is signed
+// afresh.
+// The workers of a download call it concurrently, it must be safe for
+// concurrent use.
+func WithRequestMutator(fn func(*http.Request)) Option {
+	return func(c *config) {
+		c.mutator = fn
+	}
+}
+
+// WithHeader sets the header key of every request to the value returned by
+// fn, called for each request like WithRequestMutator and before it, so a
+// rotating token stays fresh for the chunks of a long download. It is
+// called concurrently and must be safe for concurrent use.
+// Combine it with WithAllowReplay(false) for the retries to get a new value.
+func WithHeader(key string, fn func() string) Option {
+	return func(c *config) {
+		c.headerFuncs = append(c.headerFuncs, headerFunc{key: key, fn: fn})
+	}
+}
+
+// headerFunc is a header set by WithHeader.
+type headerFunc struct {
+	key string
+	fn  func() string
+}
+
+// WithURLProvider sets a hook returning the URL of every request, called
+// before WithRequestMutator, for example to get a fresh presigned URL from
+// an API when the signature expires. It is used by the reader and by all
+// the requests of the downloads, the url argument of the downloads is then
+// only the initial value of the prototype request and may be empty.
+func WithURLProvider(fn func(ctx context.Context) (string, error)) Option {
+	return func(c *config) {
+		c.urlProvider = fn
+	}
+}
+
+// prepare applies the default headers, the URL provider, the WithHeader
+// values and the mutator to a request about to be sent.
+func (c *config) prepare(req *http.Request) error {
+	c.applyDefaults(req)
+	if c.urlProvider != nil {
+		var raw, err = c.urlProvider(req.Context())
+		if err != nil {
+			return fmt.Errorf("url provider error %w", err)
+		}
+		var u *url.URL
+		if u, err = url.Parse(raw); err != nil {
+			return err
+		}
+		req.URL = u
+		req.Host = u.Host
+	}
+	for _, h := range c.headerFuncs {
+		req.Header.Set(h.key, h.fn())
+	}
+	if c.mutator != nil {
+		c.mutator(req)
+	}
+	return nil
+}
+
+// WithAllowReplay tells if a failed chunk request may be sent again as is
+// on retry, it is true by default since all requests are GETs. Set it to
+// false so every retry gets a fresh request from the prototype. With
+// WithURLProvider, WithRequestMutator or WithRetryPredicate every retry
+// gets a fresh request anyway.
+func WithAllowReplay(allow bool) Option {
+	return func(c *config) {
+		c.allowReplay = allow
+	}
+}
+
+// WithFinalValidation makes the download send one more request when all
+// the chunks are done, conditional on the ETag of the probe with If-Match
+// (or on Last-Modified with If-Unmodified-Since if the ETag is missing or
+// weak, If-Match never matches a weak one), to confirm the file did not
+// change while the chunks were downloaded. A weak ETag is also compared
+// with the one of the response.
+// It fails with ErrValidationFailed if the server reports a changed file.
+// The request only asks for the first byte, and needs a server that
+// evaluates If-Match on range requests.
+func WithFinalValidation() Option {
+	return func(c *config) {
+		c.finalValidation = true
+	}
+}
+
+// WithSequential downloads the chunks one at a time, for origins that
+// misbehave under concurrent range requests.
+func WithSequential() Option {
+	return func(c *config) {
+		c.sequential = true
+	}
+}
+
+// WithSequentialFallback makes a concurrent download go on sequentially,
+// one chunk request at a time, after n chunk requests failed with a
+// transient error. The failed chunks are retried as usual, so the retries
+// should be enabled. Stats reports when the fallback engaged.
+func WithSequentialFallback(n int) Option {
+	return func(c *config) {
+		c.fallbackAfter = n
+	}
+}
+
+// WithTransport makes the download send its requests with a new
+// http.Client around t instead of the given Requester, which may be nil.
+// The given Requester is not used at all, so a wrapper like the one of
+// NewAllowlistRequester is dropped with it.
+func WithTransport(t *http.Transport) Option {
+	return func(c *config) {
+		c.transport = t
+	}
+}
+
+// WithHeadProbe makes New learn the size, the ETag and Last-Modified with
+// a HEAD request instead of the one byte GET, to check them before a long
+// download, and fail with ErrNoRange if the server answers Accept-Ranges: none
+// before any allocation. It falls back to the GET probe if the server
+// rejects HEAD, with a 405 for example, gives no Content-Length or does not
+// answer Accept-Ranges: bytes.
+// Only use it with URLs which tolerate a change of method, the signature
+// of a presigned URL usually covers the method.
+func WithHeadProbe() Option {
+	return func(c *config) {
+		c.headProbe = true
+	}
+}
+
+// WithProbeCheck keeps the byte downloaded by the probe request and checks
+// it against every read covering offset 0, a mismatch fails the read with
+// ErrValidationFailed. It catches early a server returning inconsistent
+// content between requests, without any extra request.
+func WithProbeCheck() Option {
+	return func(c *config) {
+		c.probeCheck = true
+	}
+}
+
+// WithTimeout bounds the wall-clock time of the whole download to d,
+// from the probe request to the last chunk. The WithChunkTimeout of every
+// chunk request is cut down to the time left when the chunk starts, so
+// the chunks near the end don't overshoot the budget, and no chunk is
+// retried once it is spent.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithSerialReads makes the reader send one range request at a time,
+// the ReadAt calls of the reader and of its clones wait for each other,
+// for origins rejecting concurrent range requests of a session (409 or 423).
+// The throughput falls to the one of a single connection, with a round trip
+// per read: the downloads run with a single worker as with WithSequential,
+// so their chunks don't queue on the lock past their timeout.
+// A read holds the lock only during its own request, so it does not
+// deadlock with ReadSegments, Reader or any reader calling ReadAt.
+func WithSerialReads() Option {
+	return func(c *config) {
+		c.serialReads = true
+	}
+}
+
+// lockRead serializes the requests if WithSerialReads is set, call the returned func to unlock.
+func (c *config) lockRead() func() {
+	if !c.serialReads {
+		return func() {}
+	}
+	c.readMu.Lock()
+	return c.readMu.Unlock
+}
+
+// replayable reports whether a failed chunk request may be sent again as
+// is, the hooks preparing the requests must otherwise run again.
+func (c *config) replayable() bool {
+	return c.allowReplay && c.urlProvider == nil && c.mutator == nil && c.retryPredicate == nil
+}
+
+// withDeadline returns ctx bounded by the deadline of WithTimeout, if any.
+func (c *config) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, c.deadline)
+}
+
+// requester returns the Requester sending the requests built from clt.
+func (c *config) requester(clt Requester) Requester {
+	if c.transport != nil {
+		clt = &http.Client{Transport: c.transport}
+	}
+	return clt
+}
+
+// noteFailure counts a failed chunk request for WithSequentialFallback.
+func (c *config) noteFailure(err error) {
+	if c.fallbackAfter <= 0 || c.throttle == nil {
+		return
+	}
+	if !c.isTransient(err) {
+		return
+	}
+	if atomic.AddInt32(&c.failures, 1) == int32(c.fallbackAfter) {
+		c.throttle.pin(1)
+		atomic.StoreInt32(&c.fellBack, 1)
+	}
+}
+
+// planChunkSize returns the chunk size to use for a file of totalSize bytes.
+func (c *config) planChunkSize(totalSize int64) (int64, error) {
+	var chunkSize = c.chunkSize
+	if c.maxRequests <= 0 {
+		return chunkSize, nil
+	}
+	var count = chunkCount(totalSize, chunkSize)
+	if count <= int64(c.maxRequests) {
+		return chunkSize, nil
+	}
+	if !c.growChunk {
+		return 0, fmt.Errorf("%w: %v requests of chunk size %v, max %v",
+			ErrTooManyRequests, count, chunkSize, c.maxRequests)
+	}
+	// round up so that maxRequests chunks always cover the whole file
+	chunkSize = (totalSize + int64(c.maxRequests) - 1) / int64(c.maxRequests)
+	return chunkSize, nil
+}
+
+// ChunkCount returns the number of range requests a download of totalSize
+// bytes configured by opts makes, the last chunk included, the probe excluded.
+// It fails like the download would if the plan is over WithMaxRequests.
+func ChunkCount(totalSize int64, opts ...Option) (int, error) {
+	var cfg = newConfig(opts)
+	if err := cfg.check(); err != nil {
+		return 0, err
+	}
+	var chunkSize, err = cfg.planChunkSize(totalSize)
+	if err != nil {
+		return 0, err
+	}
+	return int(chunkCount(totalSize, chunkSize)), nil
+}
+
+func chunkCount(totalSize, chunkSize int64) int64 {
+	return (totalSize + chunkSize - 1) / chunkSize
+}
@@ -0,0 +1,279 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChunkCount(t *testing.T) {
+	var optsList = [][]Option{
+		{WithChunkSize(1)},
+		{WithChunkSize(1000)},
+		{WithChunkSize(4096), WithMaxRequests(3), WithAdaptiveChunkSize()},
+	}
+	for _, opts := range optsList {
+		for _, size := range []int64{0, 1, 999, 1000, 1001, 4096*3 + 1, 100000} {
+			var count, err = ChunkCount(size, opts...)
+			if err != nil {
+				t.Fatalf("size %v: %v", size, err)
+			}
+			var cfg = newConfig(opts)
+			var chunkSize, _ = cfg.planChunkSize(size)
+			if n := len(makeRangeTask(0, size, chunkSize)); n != count {
+				t.Errorf("size %v chunk %v: ChunkCount %v, makeRangeTask %v", size, chunkSize, count, n)
+			}
+			var iter = newTaskIter(0, size, chunkSize)
+			var n int
+			for _, ok := iter.next(); ok; _, ok = iter.next() {
+				n++
+			}
+			if n != count {
+				t.Errorf("size %v chunk %v: ChunkCount %v, taskIter %v", size, chunkSize, count, n)
+			}
+		}
+	}
+}
+
+func TestChunkCountInvalid(t *testing.T) {
+	if _, err := ChunkCount(100, WithChunkSize(0)); err == nil {
+		t.Fatal("expect an error for a zero chunk size")
+	}
+	if _, err := ChunkCount(100, WithConcurrency(-1)); err == nil {
+		t.Fatal("expect an error for a negative concurrency")
+	}
+	if _, err := ChunkCount(10000, WithChunkSize(10), WithMaxRequests(5)); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("got %v, expect ErrTooManyRequests", err)
+	}
+}
+
+// trickleRequester is a Requester sending the body of the request of
+// slowRange piece bytes at a time, every interval.
+type trickleRequester struct {
+	Requester
+	slowRange string
+	piece     int
+	interval  time.Duration
+}
+
+func (s trickleRequester) Do(req *http.Request) (*http.Response, error) {
+	var resp, err = s.Requester.Do(req)
+	if err == nil && req.Header.Get(HttpHeaderRange) == s.slowRange {
+		resp.Body = &trickleBody{ReadCloser: resp.Body, ctx: req.Context(), s: s}
+	}
+	return resp, err
+}
+
+type trickleBody struct {
+	io.ReadCloser
+	ctx context.Context
+	s   trickleRequester
+}
+
+func (b *trickleBody) Read(p []byte) (int, error) {
+	select {
+	case <-b.ctx.Done():
+		return 0, b.ctx.Err()
+	case <-time.After(b.s.interval):
+	}
+	if len(p) > b.s.piece {
+		p = p[:b.s.piece]
+	}
+	return b.ReadCloser.Read(p)
+}
+
+func TestWithChunkTimeout(t *testing.T) {
+	var data = bytes.Repeat([]byte("trickle"), 1000)
+	// the chunk at 3000 takes about 200ms
+	var clt = trickleRequester{Requester: NewFileRequester(data), slowRange: "bytes=3000-3999",
+		piece: 100, interval: 20 * time.Millisecond}
+	var tests = []struct {
+		name    string
+		timeout time.Duration
+		ok      bool
+	}{
+		{"timed out", 50 * time.Millisecond, false},
+		{"long enough", 5 * time.Second, true},
+		{"disabled", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, err = Do(context.Background(), clt, "http://example.com/f",
+				WithChunkSize(1000), WithChunkTimeout(tt.timeout), WithMaxRetries(0))
+			if tt.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatal("content differs")
+				}
+				return
+			}
+			var chunkErr *ChunkError
+			if !errors.As(err, &chunkErr) || chunkErr.Offset != 3000 || !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got %v, expect the timeout of the chunk at 3000", err)
+			}
+		})
+	}
+}
+
+func TestWithTimeoutSlowServer(t *testing.T) {
+	var data = bytes.Repeat([]byte("slow"), 10000)
+	// the chunk at 20000 takes longer than the whole budget
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get(HttpHeaderRange), "bytes=20000-") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var start = time.Now()
+	var _, err = Do(context.Background(), srv.Client(), srv.URL,
+		WithChunkSize(10000), WithTimeout(300*time.Millisecond))
+	// bounded by the budget, not by the minute of WithChunkTimeout
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("the download took %v", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expect the deadline", err)
+	}
+}
+
+func TestWithConcurrency(t *testing.T) {
+	var data = bytes.Repeat([]byte("concurrency"), 2000)
+	var requests, inFlight, maxInFlight atomic.Int32
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var n = inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			var max = maxInFlight.Load()
+			if n <= max || maxInFlight.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	var ctx = context.Background()
+
+	for _, n := range []int{1, 4} {
+		maxInFlight.Store(0)
+		var got, err = Do(ctx, srv.Client(), srv.URL, WithChunkSize(1000), WithConcurrency(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("content differs")
+		}
+		if max := maxInFlight.Load(); max > int32(n) {
+			t.Fatalf("concurrency %v: %v requests in flight", n, max)
+		}
+
+		maxInFlight.Store(0)
+		var path = filepath.Join(t.TempDir(), "f")
+		if err = DoToFile(ctx, srv.Client(), srv.URL, path, WithChunkSize(1000), WithConcurrency(n)); err != nil {
+			t.Fatal(err)
+		}
+		if max := maxInFlight.Load(); max > int32(n) {
+			t.Fatalf("concurrency %v: %v requests in flight in DoToFile", n, max)
+		}
+	}
+
+	requests.Store(0)
+	if _, err := Do(ctx, srv.Client(), srv.URL, WithConcurrency(0)); err == nil {
+		t.Fatal("expect an error for a concurrency of 0")
+	}
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("got %v requests with an invalid concurrency, expect 0", n)
+	}
+}
+
+func TestWithSerialReads(t *testing.T) {
+	var data = bytes.Repeat([]byte("0123456789"), 10000)
+	var inFlight, maxInFlight atomic.Int32
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := inFlight.Add(1); n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		defer inFlight.Add(-1)
+		time.Sleep(time.Millisecond)
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	var ra, err = NewWithOptions(srv.Client(), req, WithSerialReads(), WithReadahead(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errCh = make(chan error, 8)
+	for i := 0; i < 4; i++ {
+		// sequential reads, served by the readahead windows
+		go func(i int) {
+			var r = ra.Clone(context.Background())
+			var p = make([]byte, 100)
+			for off := int64(i * 20000); off < int64(i*20000+10000); off += 100 {
+				if _, err := r.ReadAt(p, off); err != nil {
+					errCh <- err
+					return
+				}
+				if !bytes.Equal(p, data[off:off+100]) {
+					errCh <- fmt.Errorf("read at %v differs", off)
+					return
+				}
+			}
+			errCh <- nil
+		}(i)
+		// coalesced segments
+		go func(i int) {
+			var segs = []Segment{
+				{Offset: int64(i * 1000), Buf: make([]byte, 10)},
+				{Offset: int64(i*1000 + 50), Buf: make([]byte, 10)},
+				{Offset: int64(i*1000 + 5000), Buf: make([]byte, 10)},
+			}
+			for j := 0; j < 20; j++ {
+				if err := ra.ReadSegments(segs, 100); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			for _, seg := range segs {
+				if !bytes.Equal(seg.Buf, data[seg.Offset:seg.Offset+10]) {
+					errCh <- fmt.Errorf("segment at %v differs", seg.Offset)
+					return
+				}
+			}
+			errCh <- nil
+		}(i)
+	}
+	var timeout = time.After(10 * time.Second)
+	for i := 0; i < 8; i++ {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("the serial reads deadlocked")
+		}
+	}
+	if n := maxInFlight.Load(); n != 1 {
+		t.Fatalf("got %v requests in flight, expect 1", n)
+	}
+}
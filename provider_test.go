@@ -0,0 +1,84 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestURLProviderRetry(t *testing.T) {
+	var data = bytes.Repeat([]byte("presigned"), 1000)
+	var signature atomic.Int32
+	// every other signature has expired, besides the one of the probe
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sig, _ := strconv.Atoi(r.URL.Query().Get("sig")); sig != 1 && sig%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var provider = func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("%v?sig=%v", srv.URL, signature.Add(1)), nil
+	}
+	var got, err = Do(context.Background(), srv.Client(), "", WithURLProvider(provider),
+		WithChunkSize(1000), WithConcurrency(1), WithRetryDelay(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("content differs")
+	}
+}
+
+func TestRequestMutatorRetry(t *testing.T) {
+	var data = bytes.Repeat([]byte("signed"), 1000)
+	var tests = []struct {
+		name   string
+		status int
+		opts   []Option
+	}{
+		{"transient", http.StatusServiceUnavailable, nil},
+		{"predicate", http.StatusForbidden, []Option{WithRetryPredicate(func(resp *http.Response, err error) (bool, time.Duration) {
+			return resp != nil && resp.StatusCode == http.StatusForbidden, time.Millisecond
+		})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rejected atomic.Value
+			// the first signature of the chunk at 3000 is rejected, a retry
+			// must come with a new one
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var sig = r.Header.Get("X-Signature")
+				if r.Header.Get(HttpHeaderRange) == "bytes=3000-3999" {
+					if rejected.CompareAndSwap(nil, sig) || rejected.Load() == sig {
+						w.WriteHeader(tt.status)
+						return
+					}
+				}
+				http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+			}))
+			defer srv.Close()
+
+			var signatures atomic.Int32
+			var opts = append([]Option{WithChunkSize(1000), WithRetryDelay(time.Millisecond),
+				WithRequestMutator(func(req *http.Request) {
+					req.Header.Set("X-Signature", fmt.Sprint(signatures.Add(1)))
+				})}, tt.opts...)
+			var got, err = Do(context.Background(), srv.Client(), srv.URL, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("content differs")
+			}
+		})
+	}
+}
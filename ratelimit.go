@@ -0,0 +1,105 @@
+package httprange
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithRateLimit caps the bandwidth of the response bodies to bytesPerSecond,
+// shared by all the workers of the download so the aggregate stays under
+// it whatever the concurrency. A worker waiting for its share gives up when
+// its context is done. Zero or less means no limit.
+// Keep WithStallTimeout above concurrency * chunk / bytesPerSecond or the
+// wait of a slow share may look like a stall.
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(c *config) {
+		if bytesPerSecond <= 0 {
+			c.limiter = nil
+			return
+		}
+		c.limiter = newRateLimiter(bytesPerSecond)
+	}
+}
+
+// rateLimiter is a token bucket of one second of bytes.
+// A nil limiter does not limit.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	// now and sleep are the clock, replaced by the tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// burst is the largest read a single wait covers.
+func (l *rateLimiter) burst() int {
+	if l.rate < 1 {
+		return 1
+	}
+	return int(l.rate)
+}
+
+// wait takes n tokens, waiting until the bucket has refilled the debt.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	var now = l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	if !l.sleep(ctx, delay) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// limitReader returns r reading under the limiter of c, r itself without one.
+func (c *config) limitReader(ctx context.Context, r io.Reader) io.Reader {
+	if c.limiter == nil {
+		return r
+	}
+	return &rateReader{r: r, ctx: ctx, limiter: c.limiter}
+}
+
+type rateReader struct {
+	r       io.Reader
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (r *rateReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	var n, err = r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,51 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose sleeps only advance its time.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) bool {
+	c.t = c.t.Add(d)
+	return ctx.Err() == nil
+}
+
+func TestRateLimitFakeClock(t *testing.T) {
+	var clock = &fakeClock{t: time.Unix(1, 0)}
+	var cfg = newConfig([]Option{WithRateLimit(1000)})
+	cfg.limiter.now, cfg.limiter.sleep, cfg.limiter.last = clock.now, clock.sleep, clock.t
+
+	var start = clock.t
+	var n, err = io.Copy(io.Discard, cfg.limitReader(context.Background(), bytes.NewReader(make([]byte, 5000))))
+	if err != nil || n != 5000 {
+		t.Fatalf("copied %v bytes, %v", n, err)
+	}
+	// the first second of bytes is in the bucket already
+	if elapsed := clock.t.Sub(start); elapsed < 4*time.Second || elapsed > 4*time.Second+time.Millisecond {
+		t.Fatalf("5000 bytes at 1000B/s took %v, expect 4s", elapsed)
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	var cfg = newConfig([]Option{WithRateLimit(1)})
+	var ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	var _, err = io.Copy(io.Discard, cfg.limitReader(ctx, bytes.NewReader(make([]byte, 100))))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, expect the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the wait took %v after the deadline", elapsed)
+	}
+}
@@ -0,0 +1,84 @@
+package httprange
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WithReadahead makes a ReadAt following the previous one, a sequential
+// read like the ones of SectionReader, fetch a window of size bytes ahead
+// so the next reads are served from memory. A read elsewhere in the file
+// is sent as is and drops nothing, so random access like a zip seek makes
+// no larger request. The reads of the downloads are never read ahead.
+// It is independent of WithBlockCache, a window fetch skips the blocks.
+func WithReadahead(size int) Option {
+	return func(c *config) {
+		if size <= 0 {
+			c.readahead = nil
+			return
+		}
+		c.readahead = &readahead{size: size, lastEnd: -1}
+	}
+}
+
+// readahead is the window of the last sequential reads, shared by the
+// reader and its clones.
+type readahead struct {
+	size    int
+	mu      sync.Mutex
+	lastEnd int64
+	off     int64
+	buf     []byte
+}
+
+// readWindow serves a read from the window, or fetches a new one for a
+// sequential read. It reports false, without any request, for a random
+// read which the caller fetches itself. The lock is not held during the
+// fetch, so the reads of the clones inside the window are not blocked.
+func (ra *HTTPReaderAt) readWindow(req *http.Request, p []byte, off int64) (int, bool, error) {
+	var r = ra.cfg.readahead
+	r.mu.Lock()
+	var n int
+	if off >= r.off && off < r.off+int64(len(r.buf)) {
+		n = copy(p, r.buf[off-r.off:])
+		ra.cfg.noteCache(off, n, true)
+	} else if off != r.lastEnd {
+		r.lastEnd = off + int64(len(p))
+		r.mu.Unlock()
+		return 0, false, nil
+	}
+	r.lastEnd = off + int64(len(p))
+	r.mu.Unlock()
+	if n == len(p) {
+		return n, true, nil
+	}
+
+	var pos = off + int64(n)
+	var size = r.size
+	if size < len(p)-n {
+		size = len(p) - n
+	}
+	var buf = make([]byte, size)
+	var m, err = ra.fetchAt(req, buf, pos)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, ErrValidationFailed) {
+			r.mu.Lock()
+			r.buf = nil
+			r.mu.Unlock()
+		}
+		return n, true, err
+	}
+	// a window is never written once published, the last fetch wins
+	r.mu.Lock()
+	r.off, r.buf = pos, buf[:m]
+	r.mu.Unlock()
+	var c = copy(p[n:], buf[:m])
+	ra.cfg.noteCache(pos, c, false)
+	n += c
+	if n < len(p) {
+		return n, true, io.EOF
+	}
+	return n, true, nil
+}
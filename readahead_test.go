@@ -0,0 +1,56 @@
+package httprange
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadaheadFetchUnlocked(t *testing.T) {
+	var data = bytes.Repeat([]byte("0123456789"), 50)
+	var release = make(chan struct{})
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get(HttpHeaderRange), "bytes=110-") {
+			<-release
+		}
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	var req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	var ra, err = NewWithOptions(srv.Client(), req, WithReadahead(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p = make([]byte, 10)
+	// a random read, then a sequential one fetching the window 10-109
+	for _, off := range []int64{0, 10} {
+		if _, err := ra.ReadAt(p, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a sequential read past the window, blocked in its fetch
+	go ra.ReadAt(make([]byte, 100), 20)
+	time.Sleep(50 * time.Millisecond)
+
+	var done = make(chan error, 1)
+	go func() {
+		var _, err = ra.Clone(req.Context()).ReadAt(p, 50)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("a read inside the window waited for the fetch")
+	}
+	if !bytes.Equal(p, data[50:60]) {
+		t.Fatalf("got %q", p)
+	}
+}
@@ -0,0 +1,126 @@
+package httprange
+
+import (
+	"errors"
+	"io"
+)
+
+const defaultReaderSize = 1024 * 1024
+
+// Reader is a buffered sequential reader over an HTTPReaderAt.
+// It fetches the file in large windows with a single range request each
+// and serves Read from the window, so forward scanning consumers like
+// encoding/csv or encoding/json make few requests.
+// Unlike GetReader it downloads with a single goroutine.
+// It is an io.ReadSeekCloser, a Seek inside the window keeps it.
+// It is not safe for concurrent use.
+type Reader struct {
+	ra  *HTTPReaderAt
+	buf []byte
+	// buf[r:w] is not read yet
+	r, w int
+	// off is the file offset of the next window
+	off int64
+	err error
+}
+
+var _ io.ReadSeekCloser = (*Reader)(nil)
+
+var errReaderClosed = errors.New("read on closed Reader")
+
+// NewReader returns a Reader reading ra from the start with a window of 1MiB.
+func NewReader(ra *HTTPReaderAt) *Reader {
+	return NewReaderSize(ra, defaultReaderSize)
+}
+
+// NewReaderSize returns a Reader reading ra from the start with a window
+// of size bytes, which is also the size of its buffer.
+func NewReaderSize(ra *HTTPReaderAt, size int) *Reader {
+	if size <= 0 {
+		size = defaultReaderSize
+	}
+	return &Reader{
+		ra:  ra,
+		buf: make([]byte, size),
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.r == r.w {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if len(p) >= len(r.buf) {
+			// large read, avoid the copy through the buffer
+			var n, err = r.ra.ReadAt(p, r.off)
+			r.off += int64(n)
+			r.r, r.w = 0, 0
+			r.err = err
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		var n, err = r.ra.ReadAt(r.buf, r.off)
+		r.off += int64(n)
+		r.r, r.w = 0, n
+		r.err = err
+		if n == 0 {
+			return 0, err
+		}
+	}
+	var n = copy(p, r.buf[r.r:r.w])
+	r.r += n
+	return n, nil
+}
+
+// Seek sets the offset of the next Read, io.SeekEnd needs the size of the file.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if r.buf == nil {
+		return 0, errReaderClosed
+	}
+	// the file offset of buf[0]
+	var base = r.off - int64(r.w)
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += base + int64(r.r)
+	case io.SeekEnd:
+		var size = r.ra.Size()
+		if size < 0 {
+			return 0, ErrUnknownSize
+		}
+		offset += size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset >= base && offset <= r.off {
+		r.r = int(offset - base)
+		return offset, nil
+	}
+	r.r, r.w = 0, 0
+	r.off = offset
+	r.err = nil
+	return offset, nil
+}
+
+// Close releases the buffer, the HTTPReaderAt is left open.
+func (r *Reader) Close() error {
+	r.buf = nil
+	r.r, r.w = 0, 0
+	r.err = errReaderClosed
+	return nil
+}
+
+// SectionReader returns an io.SectionReader of the whole file, every Read
+// of it is a range request, see NewReader for a buffered one.
+// The size of the file must be known.
+func (ra *HTTPReaderAt) SectionReader() *io.SectionReader {
+	return io.NewSectionReader(ra, 0, ra.Size())
+}
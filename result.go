@@ -0,0 +1,86 @@
+package httprange
+
+import (
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// DownloadResult is everything DoV2 learned about a download.
+type DownloadResult struct {
+	// Data is the content, nil if it was written to Path
+	Data []byte
+	// Path is the file given to WithOutputPath
+	Path string
+	Size int64
+	ETag string
+	// UsedRange is false if the file came in a single response, see Stats
+	UsedRange bool
+	// Digests maps a digest algorithm to the digest of the content.
+	// It always has "sha-256", and the algorithm of the digest advertised
+	// by the server if any, which is then verified.
+	Digests map[string][]byte
+	// Stats is also copied to the Stats given to WithStats, if any
+	Stats Stats
+}
+
+// WithOutputPath makes DoV2 write the content to the file at path instead
+// of returning it in memory. The chunks are then written in order, see
+// DoToFileWithCheck.
+func WithOutputPath(path string) Option {
+	return func(c *config) {
+		c.outputPath = path
+	}
+}
+
+// DoV2 downloads url like Do, or like DoToFileWithCheck with
+// WithOutputPath, and returns all the metadata of the download in one
+// DownloadResult. It fails with ErrDigestMismatch if the content does not
+// match the digest advertised by the server.
+func DoV2(ctx context.Context, clt Requester, url string, opts ...Option) (*DownloadResult, error) {
+	var result = &DownloadResult{}
+	// the Stats of WithStats in opts replaces this one, and is copied below
+	opts = append([]Option{WithStats(&result.Stats)}, opts...)
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	var cfg = preRead.cfg
+	result.Path = cfg.outputPath
+	result.Size = preRead.Size()
+	result.ETag = preRead.meta.etag
+	result.UsedRange = preRead.stored == nil
+
+	var hashes = map[string]hash.Hash{"sha-256": newDigestHash("sha-256")}
+	if alg := preRead.meta.digestAlg; alg != "" {
+		hashes[alg] = newDigestHash(alg)
+	}
+	var writers = make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	var tee = io.MultiWriter(writers...)
+
+	if cfg.outputPath != "" {
+		err = downloadToFile(ctx, preRead, chunkSize, cfg.outputPath, tee)
+	} else if result.Data, err = download(ctx, preRead, chunkSize); err == nil {
+		tee.Write(result.Data)
+	}
+	if cfg.stats.out != &result.Stats {
+		result.Stats = *cfg.stats.out
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Digests = make(map[string][]byte, len(hashes))
+	for alg, h := range hashes {
+		result.Digests[alg] = h.Sum(nil)
+	}
+	if alg := preRead.meta.digestAlg; alg != "" && !hmac.Equal(result.Digests[alg], preRead.meta.digest) {
+		return nil, fmt.Errorf("%w: %s", ErrDigestMismatch, alg)
+	}
+	return result, nil
+}
@@ -0,0 +1,253 @@
+package httprange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ResumeState is the progress of a download, saved so that an interrupted
+// download can go on without fetching the completed chunks again.
+// The chunk layout is deterministic given Size and ChunkSize.
+type ResumeState struct {
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	ChunkSize    int64  `json:"chunk_size"`
+	// Done is a bitmap with a bit set for every completed chunk
+	Done []byte `json:"done"`
+}
+
+// IsDone reports whether the chunk i is completed.
+func (s *ResumeState) IsDone(i int) bool {
+	return i/8 < len(s.Done) && s.Done[i/8]&(1<<(i%8)) != 0
+}
+
+// SetDone marks the chunk i completed.
+func (s *ResumeState) SetDone(i int) {
+	for i/8 >= len(s.Done) {
+		s.Done = append(s.Done, 0)
+	}
+	s.Done[i/8] |= 1 << (i % 8)
+}
+
+// ResumeStore persists the ResumeState of downloads, it can be backed by
+// local files, a database or an object storage.
+// Load returns an error wrapping fs.ErrNotExist if there is no state for key.
+type ResumeStore interface {
+	Load(key string) (ResumeState, error)
+	Save(key string, state ResumeState) error
+}
+
+// ResumeKey returns the key of the ResumeState of a download of url to
+// filePath. It depends on the ETag, so a state saved for another version
+// of the file is never reused, and on the absolute filePath, so downloads
+// of the same url to several files never share a state.
+func ResumeKey(url, etag, filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		filePath = abs
+	}
+	return hashFields(url, etag, filePath)
+}
+
+// FileResumeStore keeps each ResumeState in a JSON file of a directory.
+type FileResumeStore struct {
+	Dir string
+}
+
+var _ ResumeStore = (*FileResumeStore)(nil)
+
+// NewFileResumeStore returns a FileResumeStore keeping the states
+// next to the output file at outputPath.
+func NewFileResumeStore(outputPath string) *FileResumeStore {
+	return &FileResumeStore{Dir: filepath.Dir(outputPath)}
+}
+
+func (f *FileResumeStore) path(key string) string {
+	return filepath.Join(f.Dir, "."+key+".resume")
+}
+
+func (f *FileResumeStore) Load(key string) (ResumeState, error) {
+	var state ResumeState
+	var content, err = os.ReadFile(f.path(key))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(content, &state)
+	return state, err
+}
+
+// Save writes the state to a temporary file renamed over the previous one,
+// so a crash never leaves a truncated state.
+func (f *FileResumeStore) Save(key string, state ResumeState) error {
+	var content, err = json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	var tmp = f.path(key) + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path(key))
+}
+
+// Delete removes the state of key, it is not an error if there is none.
+func (f *FileResumeStore) Delete(key string) error {
+	var err = os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// DoToFileResumable downloads url to filePath like DoToFile, and can go on
+// after an interruption. The completed chunks are recorded in a ResumeState
+// saved by a FileResumeStore next to filePath after every chunk; the next
+// call for the same url and filePath only fetches the missing chunks if
+// the remote size, ETag and Last-Modified still match the state and the
+// partial file is not shorter than the state, otherwise it discards them
+// and starts fresh. A file without ETag nor Last-Modified always starts
+// fresh, another version of it would not be noticed. The state is removed
+// on success, the key of the state is ResumeKey.
+// The state survives a killed process, not a crash of the machine: the
+// file is not synced before the state is saved.
+// A file of unknown size is downloaded without resume.
+func DoToFileResumable(ctx context.Context, clt Requester, url, filePath string, opts ...Option) error {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return err
+	}
+	var size = preRead.Size()
+	if size < 0 {
+		var file *os.File
+		if file, err = os.Create(filePath); err != nil {
+			preRead.Close()
+			return err
+		}
+		err = writeChunks(ctx, preRead, chunkSize, file)
+		return closeFile(file, err)
+	}
+
+	var store = NewFileResumeStore(filePath)
+	var key = ResumeKey(url, preRead.ETag(), filePath)
+	var state ResumeState
+	state, err = store.Load(key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		preRead.Close()
+		return err
+	}
+	var flag = os.O_RDWR | os.O_CREATE
+	if err == nil && canResume(state, preRead, filePath) {
+		// keep the layout of the chunks already done
+		chunkSize = state.ChunkSize
+		preRead.cfg.stats.planChunks(0, size, chunkSize)
+	} else {
+		state = ResumeState{
+			Size:         size,
+			ETag:         preRead.ETag(),
+			LastModified: preRead.LastModified(),
+			ChunkSize:    chunkSize,
+		}
+		flag |= os.O_TRUNC
+	}
+	var file *os.File
+	if file, err = os.OpenFile(filePath, flag, 0o666); err != nil {
+		preRead.Close()
+		return err
+	}
+	if flag&os.O_TRUNC != 0 {
+		// a partial file has the full size, canResume tells a truncated one
+		if err = file.Truncate(size); err != nil {
+			preRead.Close()
+			return closeFile(file, err)
+		}
+	}
+	if err = resumeChunks(ctx, preRead, file, store, key, &state); err != nil {
+		return closeFile(file, err)
+	}
+	if err = closeFile(file, nil); err != nil {
+		return err
+	}
+	return store.Delete(key)
+}
+
+// canResume reports whether the chunks marked done in state can be kept:
+// the remote file must have the same size and validators, without any
+// validator it can't be told from another version, and the partial file
+// must still hold the bytes of the state.
+func canResume(state ResumeState, preRead *HTTPReaderAt, filePath string) bool {
+	if state.ChunkSize <= 0 || state.Size != preRead.Size() {
+		return false
+	}
+	if state.ETag == "" && state.LastModified == "" {
+		return false
+	}
+	if state.ETag != preRead.ETag() || state.LastModified != preRead.LastModified() {
+		return false
+	}
+	var info, err = os.Stat(filePath)
+	return err == nil && info.Mode().IsRegular() && info.Size() >= state.Size
+}
+
+// resumeChunks downloads the chunks of preRead not done in state into
+// file, saving state after each one.
+func resumeChunks(ctx context.Context, preRead *HTTPReaderAt, file *os.File,
+	store ResumeStore, key string, state *ResumeState) error {
+	var cfg = preRead.cfg
+	defer cfg.flushStats()
+	defer preRead.Close()
+
+	var taskList = makeRangeTask(0, state.Size, state.ChunkSize)
+	var taskCh = make(chan int, len(taskList))
+	for i := range taskList {
+		if !state.IsDone(i) {
+			taskCh <- i
+		}
+	}
+	close(taskCh)
+	if err := store.Save(key, *state); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var group, errCtx = errgroup.WithContext(ctx)
+	for i := 0; i < cfg.concurrency; i++ {
+		group.Go(func() error {
+			var buf = make([]byte, state.ChunkSize)
+			for index := range taskCh {
+				if err := errCtx.Err(); err != nil {
+					return err
+				}
+				var task = taskList[index]
+				var mt = memoryTaskType{
+					Offset:  task.Offset,
+					Content: buf[:task.Size],
+				}
+				if err := readChunk(errCtx, preRead, mt); err != nil {
+					return err
+				}
+				if _, err := file.WriteAt(mt.Content, mt.Offset); err != nil {
+					return err
+				}
+				mu.Lock()
+				state.SetDone(index)
+				var err = store.Save(key, *state)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return preRead.finalValidate(ctx)
+}
@@ -0,0 +1,149 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoToFileResumable(t *testing.T) {
+	var data = bytes.Repeat([]byte("0123456789"), 2000)
+	var requests, failAfter atomic.Int32
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := failAfter.Load(); n > 0 && requests.Add(1) > n {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	var ctx = context.Background()
+	var path = filepath.Join(t.TempDir(), "f")
+	var opts = []Option{WithChunkSize(1000), WithConcurrency(1), WithMaxRetries(0)}
+
+	// the probe and 5 chunks, then the server fails
+	failAfter.Store(6)
+	if err := DoToFileResumable(ctx, srv.Client(), srv.URL, path, opts...); err == nil {
+		t.Fatal("expect the interrupted download to fail")
+	}
+
+	failAfter.Store(0)
+	var stats Stats
+	if err := DoToFileResumable(ctx, srv.Client(), srv.URL, path, append(opts, WithStats(&stats))...); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(stats.ChunkAttempts); got != 15 {
+		t.Fatalf("resumed download read %v chunks, expect 15", got)
+	}
+	var content, _ = os.ReadFile(path)
+	if !bytes.Equal(content, data) {
+		t.Fatal("resumed file differs")
+	}
+	if _, err := os.Stat(NewFileResumeStore(path).path(ResumeKey(srv.URL, `"v1"`, path))); !os.IsNotExist(err) {
+		t.Fatalf("state not removed: %v", err)
+	}
+}
+
+func TestDoToFileResumableTwoFiles(t *testing.T) {
+	var data = bytes.Repeat([]byte("0123456789"), 2000)
+	var requests, failAfter atomic.Int32
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := failAfter.Load(); n > 0 && requests.Add(1) > n {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	var ctx = context.Background()
+	var dir = t.TempDir()
+	var a, b = filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")
+	var opts = []Option{WithChunkSize(1000), WithConcurrency(1), WithMaxRetries(0)}
+
+	// a gets 3 chunks, then b of the same url in the same directory gets 10
+	for _, interrupted := range []struct {
+		path   string
+		chunks int32
+	}{{a, 3}, {b, 10}} {
+		requests.Store(0)
+		failAfter.Store(1 + interrupted.chunks)
+		if err := DoToFileResumable(ctx, srv.Client(), srv.URL, interrupted.path, opts...); err == nil {
+			t.Fatal("expect the interrupted download to fail")
+		}
+	}
+
+	failAfter.Store(0)
+	for _, resumed := range []struct {
+		path   string
+		chunks int
+	}{{a, 17}, {b, 10}} {
+		var stats Stats
+		if err := DoToFileResumable(ctx, srv.Client(), srv.URL, resumed.path, append(opts, WithStats(&stats))...); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(stats.ChunkAttempts); got != resumed.chunks {
+			t.Fatalf("%v: resumed download read %v chunks, expect %v", resumed.path, got, resumed.chunks)
+		}
+		var content, _ = os.ReadFile(resumed.path)
+		if !bytes.Equal(content, data) {
+			t.Fatalf("%v: resumed file differs", resumed.path)
+		}
+	}
+}
+
+func TestDoToFileResumableStaleState(t *testing.T) {
+	var data = bytes.Repeat([]byte("abcdefghij"), 500)
+	var tests = []struct {
+		name       string
+		stateETag  string
+		serverETag string
+		// file is the partial file, nil for none
+		file []byte
+	}{
+		{"no file", `"v1"`, `"v1"`, nil},
+		{"truncated file", `"v1"`, `"v1"`, make([]byte, 100)},
+		{"other etag", `"v0"`, `"v1"`, make([]byte, len(data))},
+		{"no validator", "", "", make([]byte, len(data))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.serverETag != "" {
+					w.Header().Set("ETag", tt.serverETag)
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			}))
+			defer srv.Close()
+			var path = filepath.Join(t.TempDir(), "f")
+			if tt.file != nil {
+				if err := os.WriteFile(path, tt.file, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a state claiming every chunk is done
+			var state = ResumeState{Size: int64(len(data)), ETag: tt.stateETag, ChunkSize: 1000}
+			for i := 0; i < 5; i++ {
+				state.SetDone(i)
+			}
+			if err := NewFileResumeStore(path).Save(ResumeKey(srv.URL, tt.serverETag, path), state); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := DoToFileResumable(context.Background(), srv.Client(), srv.URL, path, WithChunkSize(1000)); err != nil {
+				t.Fatal(err)
+			}
+			var content, _ = os.ReadFile(path)
+			if !bytes.Equal(content, data) {
+				t.Fatalf("the stale state was trusted, file of %v bytes", len(content))
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package httprange
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxRetries    = 3
+	defaultRetryDelay    = 100 * time.Millisecond
+	defaultMaxRetryDelay = 10 * time.Second
+)
+
+// defaultRetryableStatuses are the response status codes retried by default.
+var defaultRetryableStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPredicate decides if a failed chunk request is retried and how long
+// to wait before the retry. resp is nil if no response was received,
+// otherwise its body is already closed.
+type RetryPredicate func(resp *http.Response, err error) (retry bool, after time.Duration)
+
+// WithMaxRetries sets how many times a failed chunk is retried, 0 disables retries.
+func WithMaxRetries(n int) Option {
+	return func(c *config) {
+		c.maxRetries = n
+	}
+}
+
+// WithRetryPredicate replaces the built-in IsTransient classification of
+// chunk errors, for example to retry a 403 of an expired signature.
+// The predicate runs after the failed response is received and before the
+// wait, the retry then sends a new request cloned from the prototype, so
+// it goes through the same request preparation as the first attempt.
+// The number of retries is still bounded by WithMaxRetries.
+func WithRetryPredicate(fn RetryPredicate) Option {
+	return func(c *config) {
+		c.retryPredicate = fn
+	}
+}
+
+// WithRetryableStatuses sets the response status codes worth a retry,
+// 429, 500, 502, 503 and 504 by default. It is the single list used by
+// every retry decision of a download: the chunk retries and the failures
+// counted by WithSequentialFallback.
+// A predicate set with WithRetryPredicate takes precedence, it sees every
+// failure and the list is then ignored.
+func WithRetryableStatuses(codes []int) Option {
+	return func(c *config) {
+		c.retryableStatuses = codes
+	}
+}
+
+// Backoff gives the delay before a retry, attempt is 0 for the first retry.
+type Backoff interface {
+	NextDelay(attempt int) time.Duration
+}
+
+// ExponentialBackoff doubles the delay from Base at every attempt up to Max,
+// and picks a random delay between the half and the whole of it so the
+// retries of concurrent chunks spread out. It is the default Backoff,
+// with a Base of 100ms and a Max of 10s.
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	var d = b.Max
+	if attempt < 32 && b.Base<<attempt < b.Max {
+		d = b.Base << attempt
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// WithRetryDelay sets the base delay of the default ExponentialBackoff,
+// 100ms by default, the delays still grow up to 10s. It replaces a Backoff
+// set before it by WithBackoff, and the other way around.
+func WithRetryDelay(base time.Duration) Option {
+	return func(c *config) {
+		c.backoff = ExponentialBackoff{Base: base, Max: defaultMaxRetryDelay}
+	}
+}
+
+// WithBackoff sets the Backoff of the chunk retries, for example a
+// constant or a decorrelated jitter one. A Retry-After header of the
+// failed response, delta-seconds or HTTP-date, is still honored when it
+// asks for a longer delay, see WithMaxRetryAfter.
+func WithBackoff(b Backoff) Option {
+	return func(c *config) {
+		c.backoff = b
+	}
+}
+
+// IsTransient reports whether a failed request is worth retrying:
+// 429, 500, 502, 503 and 504 responses, network errors, stalled and
+// truncated bodies. A file changed under our feet is never transient.
+func IsTransient(resp *http.Response, err error) bool {
+	return isTransient(resp, err, defaultRetryableStatuses)
+}
+
+func isTransient(resp *http.Response, err error, statuses []int) bool {
+	if resp != nil {
+		for _, code := range statuses {
+			if resp.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+	if errors.Is(err, ErrValidationFailed) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrStalled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// shouldRetry reports whether the attempt-th failure err is retried and the delay before it.
+// The Retry-After of a response, a 429 or a 503 usually, is honored when it
+// asks for longer than the backoff, up to WithMaxRetryAfter if set. A retry
+// which would wait past the deadline of ctx is not made, the error is
+// returned at once.
+func (c *config) shouldRetry(ctx context.Context, err error, attempt int) (bool, time.Duration) {
+	var resp = responseOf(err)
+	if c.retryPredicate != nil {
+		return c.retryPredicate(resp, err)
+	}
+	if !c.isTransient(err) {
+		return false, 0
+	}
+	var delay = c.backoff.NextDelay(attempt)
+	if resp != nil {
+		var after = retryAfter(resp)
+		if c.maxRetryAfter > 0 && after > c.maxRetryAfter {
+			after = c.maxRetryAfter
+		}
+		if after > delay {
+			delay = after
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false, 0
+	}
+	return true, delay
+}
+
+// WithMaxRetryAfter caps the wait asked by the Retry-After header of a
+// failed response, before a chunk retry or by the throttle of
+// WithWorkerBounds. By default the header is honored whatever its value,
+// only bounded by the deadline of the download.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(c *config) {
+		c.maxRetryAfter = d
+	}
+}
+
+// isTransient is IsTransient with the status codes of WithRetryableStatuses.
+func (c *config) isTransient(err error) bool {
+	var statuses = c.retryableStatuses
+	if statuses == nil {
+		statuses = defaultRetryableStatuses
+	}
+	return isTransient(responseOf(err), err, statuses)
+}
+
+// responseOf returns the response of a StatusError in err, nil if there is none.
+func responseOf(err error) *http.Response {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Response
+	}
+	return nil
+}
+
+// sleepContext waits d or until ctx is done, it reports whether d elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	var timer = time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,51 @@
+package httprange
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// constantBackoff waits the same delay before every retry.
+type constantBackoff time.Duration
+
+func (b constantBackoff) NextDelay(int) time.Duration { return time.Duration(b) }
+
+func TestShouldRetryRetryAfter(t *testing.T) {
+	var busy = func(after string) error {
+		var resp = &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+		resp.Header.Set("Retry-After", after)
+		return newStatusError(resp)
+	}
+	var tests = []struct {
+		name    string
+		opts    []Option
+		timeout time.Duration
+		err     error
+		retry   bool
+		delay   time.Duration
+	}{
+		{"longer than backoff", []Option{WithBackoff(constantBackoff(time.Second))}, 0, busy("3"), true, 3 * time.Second},
+		{"shorter than backoff", []Option{WithBackoff(constantBackoff(5 * time.Second))}, 0, busy("1"), true, 5 * time.Second},
+		{"longer than the backoff max", nil, 0, busy("60"), true, time.Minute},
+		{"within the deadline", nil, 2 * time.Minute, busy("60"), true, time.Minute},
+		{"past the deadline", nil, 2 * time.Second, busy("60"), false, 0},
+		{"capped", []Option{WithMaxRetryAfter(10 * time.Second)}, 0, busy("86400"), true, 10 * time.Second},
+		{"capped within the deadline", []Option{WithMaxRetryAfter(time.Second)}, 2 * time.Second, busy("60"), true, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx = context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			var retry, delay = newConfig(tt.opts).shouldRetry(ctx, tt.err, 0)
+			if retry != tt.retry || delay != tt.delay {
+				t.Fatalf("got retry %v after %v, expect %v after %v", retry, delay, tt.retry, tt.delay)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package httprange
+
+import (
+	"io"
+	"sort"
+)
+
+// Segment is a part of the file read by ReadSegments.
+type Segment struct {
+	Offset int64
+	Buf    []byte
+}
+
+// ReadSegments fills the Buf of every segment with the file bytes at its Offset.
+//
+// Segments at most maxGap bytes apart are coalesced: a single range
+// request covers all of them and the pieces are sliced out of it, the gap
+// bytes are downloaded and thrown away. A segment farther than maxGap from
+// the others gets a request of its own. Multi-range (multipart/byteranges)
+// requests are never used, servers support them poorly and coalescing is
+// cheaper when the gaps are small, so pick maxGap around the number of bytes
+// transferred in a round trip. A zero maxGap only merges touching segments.
+//
+// It fails with io.EOF if a segment ends after the end of the file.
+func (ra *HTTPReaderAt) ReadSegments(segs []Segment, maxGap int64) error {
+	var order = make([]int, 0, len(segs))
+	for i := range segs {
+		if len(segs[i].Buf) > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return segs[order[a]].Offset < segs[order[b]].Offset
+	})
+
+	for len(order) > 0 {
+		var first = segs[order[0]]
+		var start, end = first.Offset, first.Offset + int64(len(first.Buf))
+		var count = 1
+		for ; count < len(order); count++ {
+			var seg = segs[order[count]]
+			if seg.Offset > end+maxGap {
+				break
+			}
+			if segEnd := seg.Offset + int64(len(seg.Buf)); segEnd > end {
+				end = segEnd
+			}
+		}
+		if err := ra.readCovering(segs, order[:count], start, end); err != nil {
+			return err
+		}
+		order = order[count:]
+	}
+	return nil
+}
+
+// readCovering reads [start, end) with a single request into the segments of group.
+func (ra *HTTPReaderAt) readCovering(segs []Segment, group []int, start, end int64) error {
+	if len(group) == 1 {
+		var n, err = ra.ReadAt(segs[group[0]].Buf, start)
+		if err == io.EOF && n == len(segs[group[0]].Buf) {
+			err = nil
+		}
+		return err
+	}
+	var buf = make([]byte, end-start)
+	var n, err = ra.ReadAt(buf, start)
+	if err == io.EOF && n == len(buf) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, i := range group {
+		copy(segs[i].Buf, buf[segs[i].Offset-start:])
+	}
+	return nil
+}
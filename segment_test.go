@@ -0,0 +1,53 @@
+package httprange
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadSegmentsMaxGap(t *testing.T) {
+	var data = bytes.Repeat([]byte("0123456789"), 10)
+	var requests atomic.Int32
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+	var req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+	var ra, err = New(srv.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		maxGap   int64
+		requests int32
+	}{
+		// the segments are 5 bytes apart
+		{4, 2},
+		{5, 1},
+		{6, 1},
+	}
+	for _, tt := range tests {
+		var segs = []Segment{
+			{Offset: 10, Buf: make([]byte, 5)},
+			{Offset: 20, Buf: make([]byte, 5)},
+		}
+		requests.Store(0)
+		if err := ra.ReadSegments(segs, tt.maxGap); err != nil {
+			t.Fatal(err)
+		}
+		if n := requests.Load(); n != tt.requests {
+			t.Errorf("maxGap %v: %v requests, expect %v", tt.maxGap, n, tt.requests)
+		}
+		for _, seg := range segs {
+			if !bytes.Equal(seg.Buf, data[seg.Offset:seg.Offset+5]) {
+				t.Errorf("maxGap %v: segment %v got %q", tt.maxGap, seg.Offset, seg.Buf)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package httprange
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStalled error is returned if no byte of a response body arrived
+// during the time set by WithStallTimeout.
+var ErrStalled = errors.New("response body stalled")
+
+// WithStallTimeout aborts a read when no byte of the response body arrived
+// for d, the chunk is then retried like after any transient error. It is
+// finer grained than the per chunk timeout and catches servers accepting
+// the request but never sending the data. Stats reports the stalls.
+func WithStallTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.stallTimeout = d
+	}
+}
+
+// stallReader cancels the request of a body when a Read waits too long.
+type stallReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	fired   int32
+}
+
+func newStallReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *stallReader {
+	var s = &stallReader{r: r, timeout: timeout}
+	s.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&s.fired, 1)
+		cancel()
+	})
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	var n, err = s.r.Read(p)
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+	if s.stalled() {
+		return n, ErrStalled
+	}
+	return n, err
+}
+
+func (s *stallReader) stalled() bool {
+	return atomic.LoadInt32(&s.fired) == 1
+}
+
+func (s *stallReader) stop() {
+	s.timer.Stop()
+}
@@ -0,0 +1,145 @@
+package httprange
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the counters of a download, see WithStats.
+type Stats struct {
+	// Requests and Bytes count all the requests made, including the probe
+	Requests int64
+	Bytes    int64
+	// Hosts breaks the counters down by the host which served the response
+	Hosts map[string]HostStats
+	// Concurrency is the number of concurrent requests at the end of the
+	// download, it is lower than the configured one if WithWorkerBounds
+	// backed off
+	Concurrency int
+	// SequentialFallback is true if WithSequentialFallback engaged
+	SequentialFallback bool
+	// Stalls counts the reads aborted by WithStallTimeout, then retried
+	Stalls int64
+	// UsedRange is false if the file came in a single response without
+	// range, from the fallback of DownloadAny or a WithTinyFile reader,
+	// the download then ran without parallelism
+	UsedRange bool
+	// ChunkAttempts maps the offset of every chunk read by the download
+	// to the number of requests it took, more than 1 if it was retried.
+	// A chunk missing from it was not started.
+	ChunkAttempts map[int64]int
+}
+
+// HostStats are the counters of a single host.
+type HostStats struct {
+	Requests int64
+	Bytes    int64
+}
+
+// WithStats makes the download fill s when it returns, also when a chunk
+// failed. It is left untouched if the probe request fails.
+func WithStats(s *Stats) Option {
+	return func(c *config) {
+		c.stats = &statsCollector{
+			out:   s,
+			hosts: make(map[string]*HostStats),
+		}
+	}
+}
+
+// statsCollector is shared by the workers of a download.
+// A nil collector ignores all records.
+type statsCollector struct {
+	out   *Stats
+	mu    sync.Mutex
+	hosts map[string]*HostStats
+
+	// attempts has a counter per chunk from the offset start,
+	// sized before the workers start so they update it without lock
+	start     int64
+	chunkSize int64
+	attempts  []int32
+}
+
+// planChunks sizes the attempt counters for the chunks of [start, end).
+// There are none for a file of unknown size, end is then -1.
+func (s *statsCollector) planChunks(start, end, chunkSize int64) {
+	if s == nil || end < start {
+		return
+	}
+	s.start = start
+	s.chunkSize = chunkSize
+	s.attempts = make([]int32, chunkCount(end-start, chunkSize))
+}
+
+// recordAttempts sets the number of requests made for the chunk at offset.
+func (s *statsCollector) recordAttempts(offset int64, n int) {
+	if s == nil || s.chunkSize <= 0 {
+		return
+	}
+	var i = (offset - s.start) / s.chunkSize
+	if i >= 0 && i < int64(len(s.attempts)) {
+		atomic.StoreInt32(&s.attempts[i], int32(n))
+	}
+}
+
+// record counts a request and the n body bytes read from its response.
+func (s *statsCollector) record(req *http.Request, resp *http.Response, n int64) {
+	if s == nil {
+		return
+	}
+	// the response request is the last one after redirects
+	var host string
+	if resp != nil && resp.Request != nil && resp.Request.URL != nil {
+		host = resp.Request.URL.Host
+	} else if req.URL != nil {
+		host = req.URL.Host
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var h = s.hosts[host]
+	if h == nil {
+		h = &HostStats{}
+		s.hosts[host] = h
+	}
+	h.Requests++
+	h.Bytes += n
+}
+
+// snapshot returns the counters collected so far.
+func (s *statsCollector) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out = Stats{
+		Hosts: make(map[string]HostStats, len(s.hosts)),
+	}
+	for host, h := range s.hosts {
+		out.Requests += h.Requests
+		out.Bytes += h.Bytes
+		out.Hosts[host] = *h
+	}
+	out.ChunkAttempts = make(map[int64]int)
+	for i := range s.attempts {
+		if n := atomic.LoadInt32(&s.attempts[i]); n > 0 {
+			out.ChunkAttempts[s.start+int64(i)*s.chunkSize] = int(n)
+		}
+	}
+	return out
+}
+
+// flushStats writes the snapshot of the counters to the Stats given to WithStats.
+func (c *config) flushStats() {
+	if c.stats == nil {
+		return
+	}
+	var out = c.stats.snapshot()
+	out.Concurrency = c.concurrency
+	if c.throttle != nil {
+		out.Concurrency = c.throttle.concurrency()
+	}
+	out.SequentialFallback = atomic.LoadInt32(&c.fellBack) == 1
+	out.Stalls = c.stalls.Load()
+	out.UsedRange = !c.noRange.Load()
+	*c.stats.out = out
+}
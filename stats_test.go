@@ -0,0 +1,40 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatsUnknownSize(t *testing.T) {
+	var data = []byte("unknown size")
+	// a range response without the length of the file
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var first, last int64
+		if _, err := fmt.Sscanf(r.Header.Get(HttpHeaderRange), "bytes=%d-%d", &first, &last); err != nil {
+			last = int64(len(data)) - 1
+		}
+		if last >= int64(len(data)) {
+			last = int64(len(data)) - 1
+		}
+		w.Header().Set(HttpHeaderContentRange, fmt.Sprintf("bytes %d-%d/*", first, last))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[first : last+1])
+	}))
+	defer srv.Close()
+
+	var stats Stats
+	var got, err = Do(context.Background(), srv.Client(), srv.URL, WithChunkSize(1), WithStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %q", got)
+	}
+	if len(stats.ChunkAttempts) != 0 {
+		t.Fatalf("chunk attempts %v for a sequential download", stats.ChunkAttempts)
+	}
+}
@@ -0,0 +1,153 @@
+package httprange
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Store buffers the whole file when the server answers the probe with
+// a 200 response, ignoring the range, see WithStore.
+type Store interface {
+	// Save reads the whole file from r, size is the Content-Length of the
+	// response or -1, and returns the buffered file and its size.
+	// The returned io.ReaderAt is closed by HTTPReaderAt.Close if it
+	// implements io.Closer.
+	Save(r io.Reader, size int64) (io.ReaderAt, int64, error)
+}
+
+// WithStore makes New accept a server without range support: the 200
+// response of the probe is saved in s and all the reads are then served
+// from it, so the io.ReaderAt contract holds for a dumb static server.
+// Call HTTPReaderAt.Close to release the store.
+// Info.SupportsRange is false for such a reader.
+func WithStore(s Store) Option {
+	return func(c *config) {
+		c.store = s
+	}
+}
+
+// MemoryStore returns a Store keeping the file in memory.
+func MemoryStore() Store {
+	return memoryStore{}
+}
+
+type memoryStore struct{}
+
+func (memoryStore) Save(r io.Reader, size int64) (io.ReaderAt, int64, error) {
+	var buf bytes.Buffer
+	if size > 0 {
+		buf.Grow(int(size))
+	}
+	var n, err = io.Copy(&buf, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(buf.Bytes()), n, nil
+}
+
+// TempFileStore returns a Store keeping the file in a temporary file of
+// dir, os.TempDir() if dir is empty, removed by HTTPReaderAt.Close.
+func TempFileStore(dir string) Store {
+	return tempFileStore{dir: dir}
+}
+
+type tempFileStore struct {
+	dir string
+}
+
+func (s tempFileStore) Save(r io.Reader, size int64) (io.ReaderAt, int64, error) {
+	var file, err = os.CreateTemp(s.dir, "httprange-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	var n int64
+	if n, err = io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, err
+	}
+	return &tempFile{file}, n, nil
+}
+
+// tempFile is a file removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	var err = t.File.Close()
+	if rmErr := os.Remove(t.File.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// keepWhole keeps the body of the 200 response of the probe, in memory
+// for a tiny file or else in the Store, read is set to the number of
+// bytes read. It fails with ErrNoRange if it can't keep it.
+func (ra *HTTPReaderAt) keepWhole(resp *http.Response, read *int64) error {
+	var prefix []byte
+	if limit := ra.cfg.tinyLimit; limit > 0 && resp.ContentLength <= limit {
+		var err error
+		prefix, err = io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		*read = int64(len(prefix))
+		if err != nil {
+			return err
+		}
+		if int64(len(prefix)) <= limit {
+			return ra.setStored(resp, bytes.NewReader(prefix), int64(len(prefix)))
+		}
+	}
+	if ra.cfg.store == nil {
+		return newStatusError(resp)
+	}
+	var stored, size, err = ra.cfg.store.Save(io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.ContentLength)
+	*read = size
+	if err != nil {
+		return err
+	}
+	return ra.setStored(resp, stored, size)
+}
+
+func (ra *HTTPReaderAt) setStored(resp *http.Response, stored io.ReaderAt, size int64) error {
+	if resp.ContentLength != -1 && size != resp.ContentLength {
+		if c, ok := stored.(io.Closer); ok {
+			c.Close()
+		}
+		return io.ErrUnexpectedEOF
+	}
+	ra.stored = stored
+	ra.meta.start = 0
+	ra.meta.end = size - 1
+	ra.meta.size = size
+	ra.cfg.noRange.Store(true)
+	return nil
+}
+
+// readStored is readAt for a file kept by keepWhole.
+func (ra *HTTPReaderAt) readStored(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= ra.meta.size {
+		return 0, io.EOF
+	}
+	var n, err = ra.stored.ReadAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close releases the Store of a reader of a server without range support,
+// it does nothing for the other readers. The clones share the store, they
+// must not be used after Close.
+func (ra *HTTPReaderAt) Close() error {
+	if c, ok := ra.stored.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package httprange
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// GetReader downloads url concurrently like Do, but returns the content
+// as an ordered stream instead of a buffer.
+// The stream ends with io.EOF after exactly Size() bytes, any download
+// error is returned by Read instead. Close the reader to abort the download.
+func GetReader(ctx context.Context, clt Requester, url string, opts ...Option) (io.ReadCloser, error) {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	if preRead.Size() < 0 {
+		return nil, ErrUnknownSize
+	}
+	return stream(ctx, preRead, makeRangeTask(0, preRead.Size(), chunkSize)), nil
+}
+
+// GetReaderRange is like GetReader for the bytes [start, end) of the file,
+// end is clamped to the size of the file.
+//
+// With reverse the stream delivers the chunks from the last one to the
+// first one, for formats parsed from their end like logs, the bytes of
+// every chunk stay in file order. Use WithChunkSize to know where a chunk
+// ends in the stream. The chunks are then fetched from the end of the
+// range, so the memory held is still bounded by 2*concurrency chunks as
+// for a forward stream.
+func GetReaderRange(ctx context.Context, clt Requester, url string, start, end int64, reverse bool,
+	opts ...Option) (io.ReadCloser, error) {
+	var preRead, chunkSize, err = probe(ctx, clt, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	if preRead.Size() < 0 {
+		return nil, ErrUnknownSize
+	}
+	if end > preRead.Size() {
+		end = preRead.Size()
+	}
+	if start < 0 || start > end {
+		return nil, fmt.Errorf("invalid range %v-%v of size %v", start, end, preRead.Size())
+	}
+	preRead.cfg.stats.planChunks(start, end, chunkSize)
+	var taskList = makeRangeTask(start, end, chunkSize)
+	if reverse {
+		for i, j := 0, len(taskList)-1; i < j; i, j = i+1, j-1 {
+			taskList[i], taskList[j] = taskList[j], taskList[i]
+		}
+	}
+	return stream(ctx, preRead, taskList), nil
+}
+
+// stream runs fetchOrdered in background and returns its output.
+func stream(ctx context.Context, preRead *HTTPReaderAt, taskList []fileTaskType) io.ReadCloser {
+	var totalSize int64
+	for _, task := range taskList {
+		totalSize += task.Size
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	var pr, pw = io.Pipe()
+	go func() {
+		defer cancel()
+		defer preRead.cfg.flushStats()
+		defer preRead.Close()
+		var cw = &countWriter{w: pw}
+		var err = fetchOrdered(ctx, preRead, taskList, cw)
+		if err == nil && cw.n != totalSize {
+			err = io.ErrUnexpectedEOF
+		}
+		// a nil error makes the reader side get io.EOF
+		pw.CloseWithError(err)
+	}()
+	return &streamReader{PipeReader: pr, cancel: cancel}
+}
+
+type streamReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (s *streamReader) Close() error {
+	s.cancel()
+	return s.PipeReader.Close()
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	var n, err = c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type indexedTask struct {
+	index int
+	fileTaskType
+}
+
+type indexedChunk struct {
+	index   int
+	content []byte
+}
+
+// fetchOrdered downloads the tasks with concurrent workers and writes the
+// chunks to w in the order of taskList. Chunks completed out of order wait in a
+// reorder buffer, which holds at most 2*concurrency chunks so a stalled
+// chunk can not make the memory grow without bound.
+func fetchOrdered(ctx context.Context, ra *HTTPReaderAt, taskList []fileTaskType, w io.Writer) error {
+	var cfg = ra.cfg
+	var taskCh = make(chan indexedTask, len(taskList))
+	for i, task := range taskList {
+		taskCh <- indexedTask{index: i, fileTaskType: task}
+	}
+	close(taskCh)
+	var window = 2 * cfg.concurrency
+	// a worker takes a slot before it takes a task and the slot is released
+	// when the chunk is written, tasks are taken in order so the next chunk
+	// to write always owns a slot
+	var slots = make(chan struct{}, window)
+	var resultCh = make(chan indexedChunk, window)
+
+	var group, errCtx = errgroup.WithContext(ctx)
+
+	for i := 0; i < cfg.concurrency; i++ {
+		group.Go(func() error {
+			for {
+				select {
+				case <-errCtx.Done():
+					return errCtx.Err()
+				case slots <- struct{}{}:
+				}
+				var task, ok = <-taskCh
+				if !ok {
+					return nil
+				}
+				var mt = memoryTaskType{
+					Offset:  task.Offset,
+					Content: make([]byte, task.Size),
+				}
+				if err := readChunk(errCtx, ra, mt); err != nil {
+					return err
+				}
+				resultCh <- indexedChunk{index: task.index, content: mt.Content}
+			}
+		})
+	}
+
+	group.Go(func() error {
+		var pending = make(map[int][]byte, window)
+		var next int
+		for next < len(taskList) {
+			select {
+			case <-errCtx.Done():
+				return errCtx.Err()
+			case chunk := <-resultCh:
+				pending[chunk.index] = chunk.content
+			}
+			for {
+				var content, ok = pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				if _, err := w.Write(content); err != nil {
+					return err
+				}
+				next++
+				<-slots
+			}
+		}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return ra.finalValidate(ctx)
+}
@@ -0,0 +1,92 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestGetReaderRangeOrder(t *testing.T) {
+	var data = make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var clt = NewFileRequester(data)
+	var tests = []struct {
+		reverse bool
+		expect  [][]byte
+	}{
+		{false, [][]byte{data[5:15], data[15:25], data[25:35], data[35:45], data[45:47]}},
+		{true, [][]byte{data[45:47], data[35:45], data[25:35], data[15:25], data[5:15]}},
+	}
+	for _, tt := range tests {
+		var r, err = GetReaderRange(context.Background(), clt, "http://example.com/f", 5, 47, tt.reverse,
+			WithChunkSize(10), WithConcurrency(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, _ = io.ReadAll(r)
+		r.Close()
+		if expect := bytes.Join(tt.expect, nil); !bytes.Equal(got, expect) {
+			t.Fatalf("reverse %v: got %v, expect %v", tt.reverse, got, expect)
+		}
+	}
+}
+
+// failingRequester is a Requester failing the request of failRange.
+type failingRequester struct {
+	Requester
+	failRange string
+}
+
+var errInjected = errors.New("injected failure")
+
+func (f failingRequester) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(HttpHeaderRange) == f.failRange {
+		return nil, errInjected
+	}
+	return f.Requester.Do(req)
+}
+
+func TestGetReaderEOF(t *testing.T) {
+	var data = bytes.Repeat([]byte("stream"), 1000)
+	var r, err = GetReader(context.Background(), NewFileRequester(data), "http://example.com/f",
+		WithChunkSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got = make([]byte, len(data))
+	if _, err = io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("content differs")
+	}
+	// nothing more than the size of the file, then io.EOF
+	if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("got %v bytes and %v after the end, expect io.EOF", n, err)
+	}
+}
+
+func TestGetReaderError(t *testing.T) {
+	var data = bytes.Repeat([]byte("stream"), 1000)
+	var clt = failingRequester{Requester: NewFileRequester(data), failRange: "bytes=3000-3999"}
+	var r, err = GetReader(context.Background(), clt, "http://example.com/f",
+		WithChunkSize(1000), WithConcurrency(1), WithMaxRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []byte
+	got, err = io.ReadAll(r)
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("got %v, expect the chunk error", err)
+	}
+	if len(got) > 3000 || !bytes.Equal(got, data[:len(got)]) {
+		t.Fatalf("got %v bytes before the error, expect a prefix of the first 3000", len(got))
+	}
+}
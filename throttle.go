@@ -0,0 +1,172 @@
+package httprange
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithWorkerBounds makes the number of concurrent chunk requests adaptive
+// between min and max workers. The download starts with max workers, halves
+// them when the server answers 429 or 503 and waits for its Retry-After,
+// then adds one worker back after each round of successful chunks.
+// It overrides the default concurrency with max.
+func WithWorkerBounds(min, max int) Option {
+	return func(c *config) {
+		c.minWorkers = min
+		c.maxWorkers = max
+	}
+}
+
+// throttle limits the number of in-flight chunk requests with
+// additive-increase/multiplicative-decrease. A nil throttle never blocks.
+type throttle struct {
+	mu        sync.Mutex
+	min       int
+	max       int
+	limit     int
+	active    int
+	successes int
+	// resume is when new requests are allowed again after a Retry-After
+	resume time.Time
+	// maxPause caps the Retry-After waits, see WithMaxRetryAfter
+	maxPause time.Duration
+	// wake is closed and replaced on every release
+	wake chan struct{}
+}
+
+func newThrottle(min, max int) *throttle {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return &throttle{
+		min:   min,
+		max:   max,
+		limit: max,
+		wake:  make(chan struct{}),
+	}
+}
+
+// acquire waits until a request is allowed or ctx is done.
+func (t *throttle) acquire(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	for {
+		t.mu.Lock()
+		var wait = time.Until(t.resume)
+		if wait <= 0 && t.active < t.limit {
+			t.active++
+			t.mu.Unlock()
+			return nil
+		}
+		var wake = t.wake
+		t.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// release ends a request acquired before, err is its result.
+func (t *throttle) release(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if resp := throttledResponse(err); resp != nil {
+		t.limit /= 2
+		if t.limit < t.min {
+			t.limit = t.min
+		}
+		t.successes = 0
+		var after = retryAfter(resp)
+		if t.maxPause > 0 && after > t.maxPause {
+			after = t.maxPause
+		}
+		if resume := time.Now().Add(after); resume.After(t.resume) {
+			t.resume = resume
+		}
+	} else if err == nil {
+		t.successes++
+		if t.successes >= t.limit && t.limit < t.max {
+			t.limit++
+			t.successes = 0
+		}
+	}
+	close(t.wake)
+	t.wake = make(chan struct{})
+}
+
+// pin fixes the limit of concurrent requests to n for the rest of the download.
+func (t *throttle) pin(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.min, t.max, t.limit = n, n, n
+}
+
+// concurrency returns the current limit of concurrent requests.
+func (t *throttle) concurrency() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// throttledResponse returns the response of err if the server asked us to slow down.
+func throttledResponse(err error) *http.Response {
+	var resp = responseOf(err)
+	if resp == nil {
+		return nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return resp
+	}
+	return nil
+}
+
+// retryAfter returns the delay of the Retry-After header, in seconds or
+// until an HTTP-date, 0 if absent, invalid or past.
+func retryAfter(resp *http.Response) time.Duration {
+	var v = strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	var date, err = http.ParseTime(v)
+	if err != nil {
+		return 0
+	}
+	if d := time.Until(date); d > 0 {
+		return d
+	}
+	return 0
+}
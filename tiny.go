@@ -0,0 +1,14 @@
+package httprange
+
+// WithTinyFile makes New accept a server answering the probe with the
+// whole file in a 200 response, which some servers do for small files,
+// when the file is at most limit bytes. The body is kept in memory and
+// all the reads are served from it without any other request, instead of
+// failing with ErrNoRange. A larger 200 response still fails with
+// ErrNoRange, unless a Store is set with WithStore.
+// Info.SupportsRange is false for such a reader.
+func WithTinyFile(limit int64) Option {
+	return func(c *config) {
+		c.tinyLimit = limit
+	}
+}
@@ -0,0 +1,57 @@
+package httprange
+
+import "net/http"
+
+// DefaultUserAgent is the User-Agent of the requests the package sends
+// when neither the prototype request nor WithUserAgent sets one, some
+// origins reject the default one of Go. Set it to "" to send Go's.
+var DefaultUserAgent = "go-httprange/0.1"
+
+// WithUserAgent sets the User-Agent of the requests without one,
+// instead of DefaultUserAgent.
+func WithUserAgent(ua string) Option {
+	return func(c *config) {
+		c.userAgent = &ua
+	}
+}
+
+// WithDefaultHeaders adds h to the requests the package sends, a header
+// already set on the prototype request is kept. The Range header and the
+// conditional ones are owned by the package and never taken from h.
+func WithDefaultHeaders(h http.Header) Option {
+	return func(c *config) {
+		c.defaultHeaders = h.Clone()
+	}
+}
+
+// ownedHeaders are set by the package on every request that needs them.
+var ownedHeaders = map[string]bool{
+	HttpHeaderRange:       true,
+	"If-Match":            true,
+	"If-Unmodified-Since": true,
+	"If-Range":            true,
+}
+
+// applyDefaults sets the default headers missing from req, with
+// Accept-Encoding: identity.
+func (c *config) applyDefaults(req *http.Request) {
+	for key, values := range c.defaultHeaders {
+		key = http.CanonicalHeaderKey(key)
+		if ownedHeaders[key] || len(req.Header.Values(key)) > 0 {
+			continue
+		}
+		req.Header[key] = append([]string(nil), values...)
+	}
+	var ua = DefaultUserAgent
+	if c.userAgent != nil {
+		ua = *c.userAgent
+	}
+	if ua != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	// the offsets of a range are about the raw bytes, ask for them unless
+	// the prototype request or WithDefaultHeaders set another encoding
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+}
@@ -0,0 +1,66 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcceptEncodingIdentity(t *testing.T) {
+	var data = bytes.Repeat([]byte("identity"), 1000)
+	var mu sync.Mutex
+	var encodings []string
+	// without the header the transport would ask for gzip itself
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Accept-Encoding"))
+		mu.Unlock()
+		http.ServeContent(w, r, "f", time.Unix(1, 0), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	var tests = []struct {
+		name   string
+		header string
+		opts   []Option
+		expect string
+	}{
+		{"default", "", nil, "identity"},
+		{"prototype override", "gzip", nil, "gzip"},
+		{"default headers override", "", []Option{WithDefaultHeaders(http.Header{"Accept-Encoding": {"br"}})}, "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encodings = nil
+			var req, _ = http.NewRequest(http.MethodGet, srv.URL, nil)
+			if tt.header != "" {
+				req.Header.Set("Accept-Encoding", tt.header)
+			}
+			var ra, err = NewWithOptions(srv.Client(), req, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = ra.ReadAt(make([]byte, 10), 100); err != nil {
+				t.Fatal(err)
+			}
+			var opts = append([]Option{WithChunkSize(1000)}, tt.opts...)
+			if _, err = DoWithOptions(context.Background(), srv.Client(), req, opts...); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(encodings) == 0 {
+				t.Fatal("no request reached the server")
+			}
+			for _, encoding := range encodings {
+				if encoding != tt.expect {
+					t.Fatalf("a request sent Accept-Encoding %q, expect %q", encoding, tt.expect)
+				}
+			}
+		})
+	}
+}
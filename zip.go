@@ -0,0 +1,89 @@
+package httprange
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"net/http"
+)
+
+// zipTailSize covers the end of central directory record with the
+// longest possible comment, it is where archive/zip starts reading
+const zipTailSize = 64 * 1024
+
+// OpenZip opens the remote zip archive at url for random access.
+// The tail of the archive is fetched once up front with a single suffix
+// range request, so the central directory scan of archive/zip is served
+// from memory, and it works even if the server does not tell the size
+// in the probe response.
+// The returned close function cancels in-flight requests of the reader
+// and closes it, the zip.Reader must not be used after it is called.
+// The opts configure the reader, see WithCacheObserver to watch how
+// many reads the tail serves.
+func OpenZip(ctx context.Context, clt Requester, url string, opts ...Option) (*zip.Reader, func() error, error) {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(ctx)
+	var req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	var ra *HTTPReaderAt
+	if ra, err = NewWithOptions(clt, req, opts...); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	// the close function also releases the file kept by WithStore
+	var closeFn = func() error {
+		cancel()
+		return ra.Close()
+	}
+	var tail *tailReaderAt
+	if tail, err = newTailReaderAt(ra, zipTailSize); err != nil {
+		closeFn()
+		return nil, nil, err
+	}
+	var zr *zip.Reader
+	if zr, err = zip.NewReader(tail, ra.Size()); err != nil {
+		closeFn()
+		return nil, nil, err
+	}
+	return zr, closeFn, nil
+}
+
+// tailReaderAt serves reads inside the last bytes of a file from memory
+// and forwards the others to the underlying HTTPReaderAt.
+type tailReaderAt struct {
+	ra     *HTTPReaderAt
+	offset int64
+	buf    []byte
+}
+
+func newTailReaderAt(ra *HTTPReaderAt, tailSize int64) (*tailReaderAt, error) {
+	var buf = make([]byte, tailSize)
+	var n, err = ra.ReadSuffix(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &tailReaderAt{
+		ra:     ra,
+		offset: ra.Size() - int64(n),
+		buf:    buf[:n],
+	}, nil
+}
+
+func (t *tailReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < t.offset {
+		return t.ra.ReadAt(p, off)
+	}
+	var rel = off - t.offset
+	if rel >= int64(len(t.buf)) {
+		return 0, io.EOF
+	}
+	var n = copy(p, t.buf[rel:])
+	t.ra.cfg.noteCache(off, n, true)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
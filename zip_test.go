@@ -0,0 +1,114 @@
+package httprange
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOpenZip(t *testing.T) {
+	var files = map[string][]byte{
+		"a.txt":     []byte("hello"),
+		"dir/b.bin": bytes.Repeat([]byte{1, 2, 3}, 50000),
+		"empty":     nil,
+	}
+	var requests atomic.Int32
+	var srv = newCountingServer(makeZip(t, files), &requests)
+	defer srv.Close()
+
+	var zr, closeFn, err = OpenZip(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFn()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "a.txt" || names[1] != "dir/b.bin" || names[2] != "empty" {
+		t.Fatalf("got members %v", names)
+	}
+	for _, f := range zr.File {
+		var rc, err = f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content, _ = io.ReadAll(rc)
+		rc.Close()
+		if !bytes.Equal(content, files[f.Name]) {
+			t.Fatalf("%v: content differs", f.Name)
+		}
+	}
+}
+
+func TestOpenZipClosed(t *testing.T) {
+	var requests atomic.Int32
+	var srv = newCountingServer(makeZip(t, map[string][]byte{"big": make([]byte, 200*1024)}), &requests)
+	defer srv.Close()
+
+	var zr, closeFn, err = OpenZip(context.Background(), srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeFn()
+	// the member is out of the tail, reading it needs a request
+	var rc io.ReadCloser
+	if rc, err = zr.File[0].Open(); err == nil {
+		_, err = io.ReadAll(rc)
+		rc.Close()
+	}
+	if err == nil {
+		t.Fatal("expect the reads to fail after close")
+	}
+}
+
+func TestOpenZipStore(t *testing.T) {
+	var archive = makeZip(t, map[string][]byte{"a.txt": []byte("stored")})
+	var tests = []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"zip", archive, true},
+		{"not a zip", []byte("not a zip archive"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no range support, the archive is kept in the store
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(tt.data)
+			}))
+			defer srv.Close()
+			var dir = t.TempDir()
+
+			var zr, closeFn, err = OpenZip(context.Background(), srv.Client(), srv.URL, WithStore(TempFileStore(dir)))
+			if (err == nil) != tt.ok {
+				t.Fatalf("got %v, expect ok %v", err, tt.ok)
+			}
+			if err == nil {
+				var rc, err = zr.File[0].Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var content, _ = io.ReadAll(rc)
+				rc.Close()
+				if string(content) != "stored" {
+					t.Fatalf("got %q", content)
+				}
+				if err = closeFn(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Fatalf("temporary file leaked: %v", entries[0].Name())
+			}
+		})
+	}
+}